@@ -2,45 +2,339 @@ package handlers
 
 import (
 	"github.com/jmoiron/sqlx"
+	"github.com/shawnzxx/service/app/services/sales-api/handlers/v1/docgrp"
+	"github.com/shawnzxx/service/app/services/sales-api/handlers/v1/eventgrp"
+	"github.com/shawnzxx/service/app/services/sales-api/handlers/v1/productgrp"
 	"github.com/shawnzxx/service/app/services/sales-api/handlers/v1/testgrp"
 	"github.com/shawnzxx/service/app/services/sales-api/handlers/v1/usergrp"
+	"github.com/shawnzxx/service/business/core/event"
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/core/product/stores/productdb"
 	"github.com/shawnzxx/service/business/core/user"
 	"github.com/shawnzxx/service/business/core/user/stores/userdb"
+	"github.com/shawnzxx/service/business/cview/user/summary"
+	"github.com/shawnzxx/service/business/cview/user/summary/stores/summarydb"
+	"github.com/shawnzxx/service/business/sys/password"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/shawnzxx/service/business/web/auth"
+	"github.com/shawnzxx/service/business/web/idempotency"
+	"github.com/shawnzxx/service/business/web/loadshed"
+	"github.com/shawnzxx/service/business/web/ratelimit"
 	"github.com/shawnzxx/service/business/web/v1/mid"
+	"github.com/shawnzxx/service/business/web/v1/paging"
+	"github.com/shawnzxx/service/foundation/openapi"
 	"github.com/shawnzxx/service/foundation/web"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 // APIMuxConfig contains all the mandatory systems required by handlers.
 type APIMuxConfig struct {
-	Shutdown chan os.Signal
-	Log      *zap.SugaredLogger
-	Auth     *auth.Auth
-	DB       *sqlx.DB
+	Shutdown    chan os.Signal
+	Log         *zap.SugaredLogger
+	Auth        *auth.Auth
+	DB          *sqlx.DB
+	Hasher      *password.Hasher
+	Tracer      trace.Tracer
+	Limiter     *ratelimit.Limiter
+	Limits      RateLimits
+	Idempotency *idempotency.Recorder
+	Shedder     *loadshed.Limiter
+	Deadlines   Deadlines
+	CORS        mid.CORSConfig
+	Compress    mid.CompressConfig
+	Events      Events
+	Draining    <-chan struct{}
+}
+
+// RateLimits contains the rate limit policies applied to the routes.
+type RateLimits struct {
+	Standard ratelimit.Policy
+	Token    ratelimit.Policy
+}
+
+// Deadlines contains the time routes have to handle a request. Routes that
+// can stream exports get the longer Export deadline.
+type Deadlines struct {
+	Default time.Duration
+	Export  time.Duration
+}
+
+// Events contains the bus the core packages publish their changes to, and
+// the interval of the heartbeats sent to event streams.
+type Events struct {
+	Bus       *event.Bus
+	Heartbeat time.Duration
 }
 
 // APIMux constructs a http.Handler with all application routes defined.
 // Handlers design principal, input can be concrete type or interface type, but output return to caller must be a concrete type
 // func APIMux(cfg APIMuxConfig) http.Handler {
 func APIMux(cfg APIMuxConfig) *web.App {
-	app := web.NewApp(cfg.Shutdown, mid.Logger(cfg.Log), mid.Errors(cfg.Log), mid.Metrics(), mid.Panics())
+	app, _ := apiMux(cfg)
+	return app
+}
+
+// apiMux constructs the app and the spec describing its routes.
+func apiMux(cfg APIMuxConfig) (*web.App, *openapi.Spec) {
+	// Event streams stay open, so they don't hold on to the capacity of the
+	// load shedder.
+	shed := mid.Shed(cfg.Shedder, "/v1/events")
+
+	app := web.NewApp(cfg.Shutdown, cfg.Tracer, mid.Logger(cfg.Log), mid.Metrics(), mid.Compress(cfg.Compress), mid.Errors(cfg.Log, "/v1"), shed, mid.Panics())
+
+	app.EnableCORS(mid.Cors(cfg.CORS))
+
+	spec := newSpec()
 
-	app.Handle(http.MethodGet, "/test", testgrp.Test)
-	app.Handle(http.MethodGet, "/test/auth", testgrp.Test, mid.Authenticate(cfg.Auth), mid.Authorize(cfg.Auth, auth.RuleAdminOnly))
+	// Each version of the API is a group of its own, so a v2 group can be
+	// added next to v1 and the versions can evolve independently.
+	v1Routes(router{group: app.Group("/v1"), prefix: "/v1", spec: spec, auth: cfg.Auth}, cfg)
+
+	return app, spec
+}
+
+// v1Routes binds the routes of version 1 of the API.
+func v1Routes(api router, cfg APIMuxConfig) {
+	authen := mid.Authenticate(cfg.Auth)
+
+	dl := mid.Deadline(cfg.Deadlines.Default)
+	export := mid.Deadline(cfg.Deadlines.Export)
+
+	dgh := docgrp.New(api.spec)
+
+	api.Handle(openapi.Operation{
+		Method:   http.MethodGet,
+		Path:     "/openapi.json",
+		Summary:  "Returns this document.",
+		Tags:     []string{"docs"},
+		Response: map[string]any{},
+	}, dgh.OpenAPI, dl)
+
+	api.Handle(openapi.Operation{
+		Method:   http.MethodGet,
+		Path:     "/test",
+		Summary:  "Checks the service is handling requests.",
+		Tags:     []string{"test"},
+		Response: testStatus,
+	}, testgrp.Test)
+
+	api.Handle(openapi.Operation{
+		Method:   http.MethodGet,
+		Path:     "/test/auth",
+		Summary:  "Checks the service is handling authenticated requests.",
+		Tags:     []string{"test"},
+		Security: bearerAuth,
+		Rule:     auth.RuleAdminOnly,
+		Response: testStatus,
+	}, testgrp.Test, authen)
 
 	// -------------------------------------------------------------------------
 
 	// inject repo implementation into user domain
-	usrCore := user.NewCore(userdb.NewStore(cfg.Log, cfg.DB))
+	usrCore := user.NewCore(cfg.Log, userdb.NewStore(cfg.Log, cfg.DB), cfg.Hasher, cfg.Events.Bus)
+
+	smmCore := summary.NewCore(summarydb.NewStore(cfg.Log, cfg.DB))
+
+	prdCore := product.NewCore(cfg.Log, usrCore, productdb.NewStore(cfg.Log, cfg.DB), cfg.Events.Bus)
 
 	// inject user domain into handler
-	ugh := usergrp.New(usrCore)
+	ugh := usergrp.New(usrCore, smmCore, prdCore, cfg.Auth)
 
-	app.Handle(http.MethodGet, "/users", ugh.Query)
+	std := mid.RateLimit(cfg.Limiter, cfg.Limits.Standard)
+	tkn := mid.RateLimit(cfg.Limiter, cfg.Limits.Token)
 
-	return app
+	// MFA requests only carry a one-time code so they get a much smaller body
+	// limit than the web.DefaultMaxBodySize.
+	mfaBody := mid.MaxBodySize(4 << 10)
+
+	// Creating resources isn't idempotent, so retries are answered with
+	// the response to the first request. Only authorized requests are
+	// recorded, so it wraps the handler.
+	idem := mid.Idempotency(cfg.Idempotency)
+
+	users := api.Group("/users")
+
+	users.Handle(openapi.Operation{
+		Method:      http.MethodGet,
+		Path:        "/token",
+		Summary:     "Issues an API token.",
+		Description: "Users with multi-factor authentication enabled receive a challenge token to exchange at /v1/users/token/mfa instead.",
+		Tags:        []string{"auth"},
+		Security:    basicAuth,
+		Response:    openapi.OneOf{usergrp.AppToken{}, usergrp.AppChallenge{}},
+	}, ugh.Token, dl, tkn)
+
+	users.Handle(openapi.Operation{
+		Method:   http.MethodPost,
+		Path:     "/token/mfa",
+		Summary:  "Exchanges a challenge token and a one-time code for an API token.",
+		Tags:     []string{"auth"},
+		Security: mfaChallenge,
+		Request:  usergrp.AppMFACode{},
+		Response: usergrp.AppToken{},
+	}, ugh.TokenMFA, dl, mid.AuthenticateChallenge(cfg.Auth), tkn, mfaBody)
+
+	authUsers := users.Group("", authen)
+
+	authUsers.Handle(openapi.Operation{
+		Method:   http.MethodPost,
+		Path:     "/mfa",
+		Summary:  "Starts enrolling the user in multi-factor authentication.",
+		Tags:     []string{"auth"},
+		Security: bearerAuth,
+		Rule:     auth.RuleAny,
+		Response: usergrp.AppMFAEnrollment{},
+	}, ugh.EnrollMFA, dl, tkn)
+
+	authUsers.Handle(openapi.Operation{
+		Method:   http.MethodPost,
+		Path:     "/mfa/confirm",
+		Summary:  "Enables multi-factor authentication with a code from the authenticator app.",
+		Tags:     []string{"auth"},
+		Security: bearerAuth,
+		Rule:     auth.RuleAny,
+		Request:  usergrp.AppMFACode{},
+		Response: usergrp.AppRecoveryCodes{},
+	}, mfaBody(ugh.ConfirmMFA), dl, tkn)
+
+	authUsers.Handle(openapi.Operation{
+		Method:   http.MethodPost,
+		Path:     "",
+		Summary:  "Creates a user.",
+		Tags:     []string{"users"},
+		Security: bearerAuth,
+		Rule:     auth.RuleAdminOnly,
+		Params:   []openapi.Param{idempotencyKey},
+		Request:  usergrp.AppNewUser{},
+		Status:   http.StatusCreated,
+		Response: usergrp.AppUser{},
+	}, idem(ugh.Create), dl, std)
+
+	authUsers.Handle(openapi.Operation{
+		Method:      http.MethodGet,
+		Path:        "",
+		Summary:     "Returns a page of users.",
+		Description: "Fields the caller isn't allowed to see are redacted, and results can't be filtered or ordered by them. Only the fields asked for are returned. " + filterDescription(user.FilterFields),
+		Tags:        []string{"users"},
+		Security:    bearerAuth,
+		Rule:        auth.RuleAny,
+		Params:      userQueryParams(),
+		Response:    paging.Response[usergrp.AppUser]{},
+		Streams:     streams,
+	}, ugh.Query, export, std)
+
+	authUsers.Handle(openapi.Operation{
+		Method:   http.MethodGet,
+		Path:     "/summary",
+		Summary:  "Returns a page of users with the totals of their products.",
+		Tags:     []string{"users"},
+		Security: bearerAuth,
+		Rule:     auth.RuleAdminOnly,
+		Params:   summaryQueryParams(),
+		Response: paging.Response[usergrp.AppSummary]{},
+		Streams:  streams,
+	}, ugh.QuerySummary, export, std)
+
+	authUsers.Handle(openapi.Operation{
+		Method:      http.MethodGet,
+		Path:        "/:user_id",
+		Summary:     "Returns a user.",
+		Description: "Fields the caller isn't allowed to see are redacted. The ETag of the response is the version of the user, with the redactions applied to it when there are any.",
+		Tags:        []string{"users"},
+		Security:    bearerAuth,
+		Rule:        auth.RuleAny,
+		Params:      []openapi.Param{ifNoneMatch},
+		Response:    usergrp.AppUser{},
+	}, ugh.QueryByID, dl, std)
+
+	authUsers.Handle(openapi.Operation{
+		Method:   http.MethodPut,
+		Path:     "/:user_id",
+		Summary:  "Updates a user.",
+		Tags:     []string{"users"},
+		Security: bearerAuth,
+		Rule:     auth.RuleAdminOrSubject,
+		Params:   []openapi.Param{ifMatch},
+		Request:  usergrp.AppUpdateUser{},
+		Response: usergrp.AppUser{},
+	}, ugh.Update, dl, std)
+
+	authUsers.Handle(openapi.Operation{
+		Method:   http.MethodDelete,
+		Path:     "/:user_id",
+		Summary:  "Deletes a user.",
+		Tags:     []string{"users"},
+		Security: bearerAuth,
+		Rule:     auth.RuleAdminOrSubject,
+		Params:   []openapi.Param{ifMatch},
+		Status:   http.StatusNoContent,
+	}, ugh.Delete, dl, std)
+
+	authUsers.Handle(openapi.Operation{
+		Method:      http.MethodPost,
+		Path:        "/:user_id/impersonate",
+		Summary:     "Issues a token to act as the user.",
+		Description: "Admins and the caller can't be impersonated, and the token never grants admin rights.",
+		Tags:        []string{"users"},
+		Security:    bearerAuth,
+		Rule:        auth.RuleAdminOnly,
+		Response:    usergrp.AppToken{},
+	}, ugh.Impersonate, dl, std)
+
+	// -------------------------------------------------------------------------
+
+	pgh := productgrp.New(prdCore)
+
+	products := api.Group("/products", authen)
+
+	products.Handle(openapi.Operation{
+		Method:   http.MethodPost,
+		Path:     "",
+		Summary:  "Creates a product owned by the caller.",
+		Tags:     []string{"products"},
+		Security: bearerAuth,
+		Rule:     auth.RuleAny,
+		Params:   []openapi.Param{idempotencyKey},
+		Request:  productgrp.AppNewProduct{},
+		Status:   http.StatusCreated,
+		Response: productgrp.AppProduct{},
+	}, idem(pgh.Create), dl, std)
+
+	products.Handle(openapi.Operation{
+		Method:      http.MethodGet,
+		Path:        "",
+		Summary:     "Returns a page of products.",
+		Description: filterDescription(product.FilterFields),
+		Tags:        []string{"products"},
+		Security:    bearerAuth,
+		Rule:        auth.RuleAny,
+		Params:      productQueryParams(),
+		Response:    paging.Response[productgrp.AppProduct]{},
+		Streams:     streams,
+	}, pgh.Query, export, std)
+
+	// -------------------------------------------------------------------------
+
+	egh := eventgrp.New(cfg.Events.Bus, cfg.Auth, cfg.Events.Heartbeat, cfg.Draining)
+
+	// Event streams stay open until the client goes away or the service
+	// shuts down, so they have no deadline.
+	api.Handle(openapi.Operation{
+		Method:      http.MethodGet,
+		Path:        "/events",
+		Summary:     "Streams the changes made to users and products as server-sent events.",
+		Description: "Users receive the events for what they own and admins receive all of them. The data of each event is an AppEvent. A client resuming after events that are no longer kept receives a reset event first.",
+		Tags:        []string{"events"},
+		Security:    bearerAuth,
+		Rule:        auth.RuleAny,
+		Params: []openapi.Param{
+			openapi.Header("Last-Event-ID", "The id of the last event received. The events since are sent first."),
+			openapi.Query("lastEventID", "The Last-Event-ID, for clients that can't set headers."),
+		},
+		Streams: []string{web.ContentTypeEventStream},
+	}, egh.Stream, authen, std)
 }
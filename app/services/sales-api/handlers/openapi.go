@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/core/user"
+	"github.com/shawnzxx/service/business/cview/user/summary"
+	"github.com/shawnzxx/service/business/data/filter"
+	"github.com/shawnzxx/service/business/data/order"
+	"github.com/shawnzxx/service/business/web/auth"
+	v1 "github.com/shawnzxx/service/business/web/v1"
+	"github.com/shawnzxx/service/business/web/v1/mid"
+	"github.com/shawnzxx/service/foundation/openapi"
+	"github.com/shawnzxx/service/foundation/web"
+	"go.uber.org/zap"
+)
+
+// Set of security schemes routes are authenticated with.
+const (
+	basicAuth    = "basicAuth"
+	bearerAuth   = "bearerAuth"
+	mfaChallenge = "mfaChallenge"
+)
+
+// OpenAPI returns the description of the routes bound by APIMux. Each route
+// is described where it's bound, so the document follows from the routes.
+func OpenAPI() *openapi.Spec {
+	_, spec := apiMux(APIMuxConfig{
+		Shutdown: make(chan os.Signal, 1),
+		Log:      zap.NewNop().Sugar(),
+	})
+
+	return spec
+}
+
+// newSpec constructs the spec the routes are described in, with the
+// security schemes and error responses they share.
+func newSpec() *openapi.Spec {
+	spec := openapi.New("Sales API", "v1")
+
+	spec.AddSecurity(basicAuth, openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "basic",
+		Description: "The email and password of the user.",
+	})
+	spec.AddSecurity(bearerAuth, openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+	})
+	spec.AddSecurity(mfaChallenge, openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "The challenge token issued in place of an API token to users with multi-factor authentication enabled.",
+	})
+
+	spec.SetErrors(map[string]any{
+		"application/json":    v1.ErrorResponse{},
+		v1.ProblemContentType: v1.Problem{},
+	})
+
+	return spec
+}
+
+// =============================================================================
+
+// router binds routes to a group of the app and adds the operation
+// describing each route to the spec as it's bound. The authorization rule
+// of an operation is the rule the route enforces.
+type router struct {
+	group  *web.Group
+	prefix string
+	spec   *openapi.Spec
+	auth   *auth.Auth
+}
+
+// Group returns a router for the routes nested in the group, like
+// web.Group.Group.
+func (rt router) Group(prefix string, mw ...web.Middleware) router {
+	return router{
+		group:  rt.group.Group(prefix, mw...),
+		prefix: rt.prefix + strings.TrimSuffix(prefix, "/"),
+		spec:   rt.spec,
+		auth:   rt.auth,
+	}
+}
+
+// Handle binds the handler to the method and path of the operation, which is
+// relative to the group, and adds the operation to the spec. The middleware
+// runs before the authorization rule of the operation is checked, so
+// middleware that must only run for authorized requests, like idempotency,
+// wraps the handler instead.
+func (rt router) Handle(op openapi.Operation, handler web.Handler, mw ...web.Middleware) {
+	path := op.Path
+	op.Path = rt.prefix + path
+	rt.spec.Add(op)
+
+	if op.Rule != "" {
+		mw = append(mw[:len(mw):len(mw)], mid.Authorize(rt.auth, op.Rule))
+	}
+
+	rt.group.Handle(op.Method, path, handler, mw...)
+}
+
+// =============================================================================
+
+// Set of parameters shared by operations.
+var (
+	idempotencyKey = openapi.Header("Idempotency-Key", "Retries of the request with the same key are answered with the response to the first request.")
+	ifNoneMatch    = openapi.Header("If-None-Match", "The ETag of a cached copy. The response is 304 when it's still current.")
+	ifMatch        = openapi.Header("If-Match", "The ETag of the user the change is based on. The response is 412 when the user has been modified since.")
+)
+
+// streams are the content types query results can be exported as.
+var streams = []string{web.ContentTypeCSV, web.ContentTypeNDJSON}
+
+// testStatus is the response of the test routes.
+var testStatus = struct {
+	Status string
+}{}
+
+// userQueryParams describes the query parameters of the user query.
+func userQueryParams() []openapi.Param {
+	return append(pageParams(),
+		orderParam(user.OrderByID, user.OrderByName, user.OrderByEmail, user.OrderByRoles, user.OrderByEnabled, user.OrderByDepartment),
+		openapi.Query("user_id", "Filter by the id of the user."),
+		openapi.Query("email", "Filter by the email of the user."),
+		openapi.Param{Name: "start_created_date", In: "query", Description: "Filter users created at or after the time.", Type: "string", Format: "date-time"},
+		openapi.Param{Name: "end_created_date", In: "query", Description: "Filter users created at or before the time.", Type: "string", Format: "date-time"},
+		openapi.Query("name", "Filter by the name of the user."),
+		openapi.Query("fields", "The fields of the users to return, like id,name. The fields are "+strings.Join([]string{user.FieldID, user.FieldName, user.FieldEmail, user.FieldRoles, user.FieldDepartment, user.FieldEnabled, user.FieldMFAEnabled, user.FieldDateCreated, user.FieldDateUpdated}, ", ")+"."),
+		openapi.Query("include", "The related resources to embed in the users, which is products. Each user gets a products field with the id, name, cost, quantity, dateCreated and dateUpdated of its products. Exports can't embed them."),
+	)
+}
+
+// summaryQueryParams describes the query parameters of the summary query.
+func summaryQueryParams() []openapi.Param {
+	return append(pageParams(),
+		orderParam(summary.OrderByUserID, summary.OrderByUserName),
+		openapi.Query("user_id", "Filter by the id of the user."),
+		openapi.Query("user_name", "Filter by the name of the user."),
+	)
+}
+
+// productQueryParams describes the query parameters of the product query.
+func productQueryParams() []openapi.Param {
+	return append(pageParams(),
+		orderParam(product.OrderByProdID, product.OrderByName, product.OrderByCost, product.OrderByQuantity, product.OrderByUserID),
+		openapi.Query("product_id", "Filter by the id of the product."),
+		openapi.Query("name", "Filter by the name of the product."),
+		openapi.Param{Name: "cost", In: "query", Description: "Filter by the cost of the product.", Type: "number"},
+		openapi.Param{Name: "quantity", In: "query", Description: "Filter by the quantity of the product.", Type: "integer"},
+	)
+}
+
+// pageParams describes the query parameters of paging.ParseRequest.
+func pageParams() []openapi.Param {
+	return []openapi.Param{
+		{Name: "page", In: "query", Description: "The page to return, starting at 1.", Type: "integer"},
+		{Name: "rows", In: "query", Description: "The number of rows per page.", Type: "integer"},
+		openapi.Query("cursor", "The nextCursor or prevCursor of a page, to return the page after or before it. It can't be used with page, and the order must be the same."),
+	}
+}
+
+// filterDescription describes the query parameters of filter.Parse for the
+// fields, which can't be listed as they're named after each operator.
+func filterDescription(fields filter.Fields) string {
+	return fmt.Sprintf("Results are filtered with query parameters like name[ilike]=gop, which compare a field with an operator. The values of in are separated by commas and like and ilike match anywhere in the field. Conditions on several fields must all hold. The fields and their operators are %s.", strings.Join(fields.Names(), ", "))
+}
+
+// orderParam describes the orderBy query parameter for the fields.
+func orderParam(fields ...string) openapi.Param {
+	desc := fmt.Sprintf("Up to %d fields and directions to order by, like name,DESC;email,ASC. The fields are %s.", order.MaxFields, strings.Join(fields, ", "))
+	return openapi.Query("orderBy", desc)
+}
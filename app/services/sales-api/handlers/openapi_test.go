@@ -0,0 +1,184 @@
+package handlers_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/shawnzxx/service/app/services/sales-api/handlers"
+	"github.com/shawnzxx/service/business/web/auth"
+	"github.com/shawnzxx/service/business/web/idempotency"
+	"github.com/shawnzxx/service/business/web/loadshed"
+	"github.com/shawnzxx/service/business/web/ratelimit"
+	"github.com/shawnzxx/service/foundation/keystore"
+	"github.com/shawnzxx/service/foundation/web"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+// TestOpenAPIRoutes fails when a route is bound by APIMux without being
+// described in the OpenAPI document, or the other way around.
+func TestOpenAPIRoutes(t *testing.T) {
+	app := handlers.APIMux(handlers.APIMuxConfig{
+		Shutdown: make(chan os.Signal, 1),
+		Log:      zap.NewNop().Sugar(),
+	})
+
+	doc, err := handlers.OpenAPI().Document()
+	if err != nil {
+		t.Fatalf("Should be able to build the document: %s", err)
+	}
+
+	routes := make(map[string]bool)
+	for _, route := range app.Routes() {
+		routes[route] = true
+	}
+
+	described := make(map[string]bool)
+	for _, route := range doc.Routes() {
+		described[route] = true
+	}
+
+	for route := range routes {
+		if !described[route] {
+			t.Errorf("Route %q should be described in the document.", route)
+		}
+	}
+
+	for route := range described {
+		if !routes[route] {
+			t.Errorf("Operation %q of the document should be bound by APIMux.", route)
+		}
+	}
+
+	if len(routes) == 0 {
+		t.Errorf("APIMux should bind routes.")
+	}
+}
+
+// TestOpenAPIRules fails when the authorization rule a route enforces isn't
+// the rule its operation describes. Each route is called with an admin
+// token, and the rule is read from the span of the Authorize middleware.
+func TestOpenAPIRules(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Should be able to generate a key: %s", err)
+	}
+
+	const kid = "test"
+	ks := keystore.NewMap(map[string]keystore.PrivateKey{
+		kid: {PK: pk, PEM: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)})},
+	})
+
+	a, err := auth.New(auth.Config{
+		Log:       zap.NewNop().Sugar(),
+		KeyLookup: ks,
+		Issuer:    "test",
+		ActiveKID: kid,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct auth: %s", err)
+	}
+
+	limiter, err := ratelimit.New(ratelimit.Config{
+		Log:   zap.NewNop().Sugar(),
+		Store: ratelimit.NewMemoryStore(),
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the rate limiter: %s", err)
+	}
+
+	limit := ratelimit.Policy{
+		Default: ratelimit.Limit{Requests: 1000, Window: time.Minute},
+	}
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	app := handlers.APIMux(handlers.APIMuxConfig{
+		Shutdown: make(chan os.Signal, 1),
+		Log:      zap.NewNop().Sugar(),
+		Auth:     a,
+		Tracer:   tp.Tracer("test"),
+		Limiter:  limiter,
+		Limits: handlers.RateLimits{
+			Standard: limit,
+			Token:    limit,
+		},
+		Idempotency: idempotency.New(idempotency.Config{
+			Log:   zap.NewNop().Sugar(),
+			Store: idempotency.NewMemoryStore(),
+			TTL:   time.Minute,
+		}),
+		Shedder: loadshed.New(loadshed.Config{InitialLimit: 10}),
+		Deadlines: handlers.Deadlines{
+			Default: time.Second,
+			Export:  time.Second,
+		},
+	})
+
+	claims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token, err := a.GenerateToken(kid, claims)
+	if err != nil {
+		t.Fatalf("Should be able to generate a token: %s", err)
+	}
+
+	for _, op := range handlers.OpenAPI().Operations() {
+		route := op.Method + " " + op.Path
+
+		if op.Security == "bearerAuth" && op.Rule == "" {
+			t.Errorf("Route %q takes a bearer token and should be authorized with a rule.", route)
+		}
+
+		if op.Rule == "" {
+			continue
+		}
+
+		path := strings.ReplaceAll(op.Path, ":user_id", uuid.NewString())
+
+		r := httptest.NewRequest(op.Method, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Route %q should refuse a token without roles with a 403, got %d.", route, w.Code)
+		}
+
+		traceID := w.Header().Get(web.TraceIDHeader)
+
+		var rule string
+		for _, span := range sr.Ended() {
+			if span.Name() != "business.web.v1.mid.authorize" || span.SpanContext().TraceID().String() != traceID {
+				continue
+			}
+			for _, attr := range span.Attributes() {
+				if attr.Key == "rule" {
+					rule = attr.Value.AsString()
+				}
+			}
+		}
+
+		if rule != op.Rule {
+			t.Errorf("Route %q should be authorized with the rule %q of its operation, got %q.", route, op.Rule, rule)
+		}
+	}
+}
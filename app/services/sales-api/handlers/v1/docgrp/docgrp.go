@@ -0,0 +1,33 @@
+// Package docgrp maintains the group of handlers for the API documentation.
+package docgrp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/shawnzxx/service/foundation/openapi"
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// Handlers manages the set of documentation endpoints.
+type Handlers struct {
+	spec *openapi.Spec
+}
+
+// New constructs a handlers for route access.
+func New(spec *openapi.Spec) *Handlers {
+	return &Handlers{
+		spec: spec,
+	}
+}
+
+// OpenAPI returns the OpenAPI document describing the API.
+func (h *Handlers) OpenAPI(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	doc, err := h.spec.Document()
+	if err != nil {
+		return fmt.Errorf("document: %w", err)
+	}
+
+	return web.Respond(ctx, w, doc, http.StatusOK)
+}
@@ -0,0 +1,157 @@
+// Package eventgrp maintains the group of handlers for streaming events.
+package eventgrp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/shawnzxx/service/business/core/event"
+	"github.com/shawnzxx/service/business/web/auth"
+	v1 "github.com/shawnzxx/service/business/web/v1"
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// resetEvent is the name of the event sent when a client can't resume
+// without missing events.
+const resetEvent = "reset"
+
+// retryDelay is how long clients wait before reconnecting once a stream
+// ends, like when the service shuts down.
+const retryDelay = 3 * time.Second
+
+// Handlers manages the set of event endpoints.
+type Handlers struct {
+	bus       *event.Bus
+	auth      *auth.Auth
+	heartbeat time.Duration
+	draining  <-chan struct{}
+}
+
+// New constructs a handlers for route access. Streams send a heartbeat at
+// the interval, and end when the draining channel is closed so they don't
+// hold up the shutdown.
+func New(bus *event.Bus, a *auth.Auth, heartbeat time.Duration, draining <-chan struct{}) *Handlers {
+	return &Handlers{
+		bus:       bus,
+		auth:      a,
+		heartbeat: heartbeat,
+		draining:  draining,
+	}
+}
+
+// Stream sends the changes made to users and products as server-sent
+// events. Callers only receive the events for what they're allowed to see.
+// A client that reconnects with the Last-Event-ID header receives the
+// events it missed, or a reset event when they're no longer kept. The
+// stream ends when the caller's token expires, since what the caller is
+// allowed to see is only decided once.
+func (h *Handlers) Stream(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	select {
+	case <-h.draining:
+		return v1.NewRequestError(errors.New("service is shutting down"), http.StatusServiceUnavailable)
+	default:
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventID")
+	}
+
+	sub, missed, complete := h.bus.Subscribe(lastID)
+	defer h.bus.Unsubscribe(sub)
+
+	es, err := web.NewEventStream(ctx, w, retryDelay)
+	if err != nil {
+		return err
+	}
+
+	allowed := filter(ctx, h.auth)
+
+	if !complete {
+		if err := es.Send("", resetEvent, AppReset{LastEventID: lastID}); err != nil {
+			return err
+		}
+	}
+
+	for _, evt := range missed {
+		if !allowed(evt) {
+			continue
+		}
+
+		if err := es.Send(evt.ID, evt.Name(), toAppEvent(evt)); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	// A nil channel never receives, so a caller without an expiry, like a
+	// client certificate, keeps the stream until it goes away.
+	var expired <-chan time.Time
+	if exp := auth.GetClaims(ctx).ExpiresAt; exp != nil {
+		timer := time.NewTimer(time.Until(exp.Time))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-h.draining:
+			return nil
+
+		// The client reconnects with a new token and resumes after the
+		// last event it received.
+		case <-expired:
+			return nil
+
+		case <-ticker.C:
+			if err := es.Heartbeat(); err != nil {
+				return err
+			}
+
+		case evt, ok := <-sub.Events():
+
+			// The subscription is closed when the client fell too far
+			// behind. The client reconnects and resumes from the buffer.
+			if !ok {
+				return nil
+			}
+
+			if !allowed(evt) {
+				continue
+			}
+
+			if err := es.Send(evt.ID, evt.Name(), toAppEvent(evt)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// filter returns a function that reports if the caller is allowed to see
+// an event. Users see the events for what they own and admins see all of
+// them. The decision for each owner is remembered for the stream.
+func filter(ctx context.Context, a *auth.Auth) func(event.Event) bool {
+	claims := auth.GetClaims(ctx)
+	decisions := make(map[string]bool)
+
+	return func(evt event.Event) bool {
+		if evt.OwnerID == "" {
+			return false
+		}
+
+		allowed, exists := decisions[evt.OwnerID]
+		if !exists {
+			allowed = a.Authorize(ctx, claims, evt.OwnerID, auth.RuleAdminOrSubject) == nil
+			decisions[evt.OwnerID] = allowed
+		}
+
+		return allowed
+	}
+}
@@ -0,0 +1,32 @@
+package eventgrp
+
+import (
+	"time"
+
+	"github.com/shawnzxx/service/business/core/event"
+)
+
+// AppEvent represents a change made to a user or product.
+type AppEvent struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	EntityID string `json:"entityID"`
+	OwnerID  string `json:"ownerID"`
+	Time     string `json:"time"`
+}
+
+func toAppEvent(evt event.Event) AppEvent {
+	return AppEvent{
+		ID:       evt.ID,
+		Type:     evt.Name(),
+		EntityID: evt.EntityID,
+		OwnerID:  evt.OwnerID,
+		Time:     evt.Time.Format(time.RFC3339Nano),
+	}
+}
+
+// AppReset tells the client that events may have been missed since the
+// event it resumed after, so what it knows should be loaded again.
+type AppReset struct {
+	LastEventID string `json:"lastEventID"`
+}
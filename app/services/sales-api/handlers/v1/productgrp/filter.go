@@ -0,0 +1,58 @@
+package productgrp
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/data/filter"
+	"github.com/shawnzxx/service/business/sys/validate"
+)
+
+func parseFilter(r *http.Request) (product.QueryFilter, error) {
+	values := r.URL.Query()
+
+	var qf product.QueryFilter
+
+	if productID := values.Get("product_id"); productID != "" {
+		id, err := uuid.Parse(productID)
+		if err != nil {
+			return product.QueryFilter{}, validate.NewFieldsError("product_id", err)
+		}
+		qf.WithProductID(id)
+	}
+
+	if name := values.Get("name"); name != "" {
+		qf.WithName(name)
+	}
+
+	if cost := values.Get("cost"); cost != "" {
+		c, err := strconv.ParseFloat(cost, 64)
+		if err != nil {
+			return product.QueryFilter{}, validate.NewFieldsError("cost", err)
+		}
+		qf.WithCost(c)
+	}
+
+	if quantity := values.Get("quantity"); quantity != "" {
+		q, err := strconv.Atoi(quantity)
+		if err != nil {
+			return product.QueryFilter{}, validate.NewFieldsError("quantity", err)
+		}
+		qf.WithQuantity(q)
+	}
+
+	// Keys like cost[gte] hold conditions compared with an operator.
+	conds, err := filter.Parse(r, product.FilterFields)
+	if err != nil {
+		return product.QueryFilter{}, err
+	}
+	qf.WithConditions(conds)
+
+	if err := qf.Validate(); err != nil {
+		return product.QueryFilter{}, err
+	}
+
+	return qf, nil
+}
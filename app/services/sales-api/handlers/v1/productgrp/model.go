@@ -0,0 +1,70 @@
+package productgrp
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/sys/validate"
+)
+
+// AppProduct represents an individual product.
+type AppProduct struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Cost        float64 `json:"cost"`
+	Quantity    int     `json:"quantity"`
+	Sold        int     `json:"sold"`
+	Revenue     int     `json:"revenue"`
+	UserID      string  `json:"userID"`
+	DateCreated string  `json:"dateCreated"`
+	DateUpdated string  `json:"dateUpdated"`
+}
+
+func toAppProduct(prd product.Product) AppProduct {
+	return AppProduct{
+		ID:          prd.ID.String(),
+		Name:        prd.Name,
+		Cost:        prd.Cost,
+		Quantity:    prd.Quantity,
+		Sold:        prd.Sold,
+		Revenue:     prd.Revenue,
+		UserID:      prd.UserID.String(),
+		DateCreated: prd.DateCreated.Format(time.RFC3339),
+		DateUpdated: prd.DateUpdated.Format(time.RFC3339),
+	}
+}
+
+func toAppProducts(prds []product.Product) []AppProduct {
+	items := make([]AppProduct, len(prds))
+	for i, prd := range prds {
+		items[i] = toAppProduct(prd)
+	}
+	return items
+}
+
+// =============================================================================
+
+// AppNewProduct contains information needed to create a new product.
+type AppNewProduct struct {
+	Name     string  `json:"name" validate:"required"`
+	Cost     float64 `json:"cost" validate:"required,gte=0"`
+	Quantity int     `json:"quantity" validate:"required,gte=1"`
+}
+
+func toCoreNewProduct(app AppNewProduct, userID uuid.UUID) product.NewProduct {
+	return product.NewProduct{
+		Name:     app.Name,
+		Cost:     app.Cost,
+		Quantity: app.Quantity,
+		UserID:   userID,
+	}
+}
+
+// Validate checks the data in the model is considered clean.
+func (app AppNewProduct) Validate() error {
+	if err := validate.Check(app); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package productgrp
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/data/order"
+	"github.com/shawnzxx/service/business/sys/validate"
+)
+
+var orderByFields = map[string]struct{}{
+	product.OrderByProdID:   {},
+	product.OrderByName:     {},
+	product.OrderByCost:     {},
+	product.OrderByQuantity: {},
+	product.OrderByUserID:   {},
+}
+
+func parseOrder(r *http.Request) ([]order.By, error) {
+	orderBy, err := order.Parse(r, product.DefaultOrderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ob := range orderBy {
+		if _, exists := orderByFields[ob.Field]; !exists {
+			return nil, validate.NewFieldsError(ob.Field, errors.New("order field does not exist"))
+		}
+	}
+
+	return orderBy, nil
+}
@@ -0,0 +1,96 @@
+// Package productgrp maintains the group of handlers for product access.
+package productgrp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/web/auth"
+	"github.com/shawnzxx/service/business/web/v1/paging"
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// Handlers manages the set of product endpoints.
+type Handlers struct {
+	product *product.Core
+}
+
+// New constructs a handlers for route access.
+func New(product *product.Core) *Handlers {
+	return &Handlers{
+		product: product,
+	}
+}
+
+// Create adds a new product owned by the authenticated user.
+func (h *Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var app AppNewProduct
+	if err := web.Decode(r, &app); err != nil {
+		return err
+	}
+
+	userID, err := auth.GetUserID(ctx)
+	if err != nil {
+		return auth.NewAuthError("invalid subject: %s", err)
+	}
+
+	prd, err := h.product.Create(ctx, toCoreNewProduct(app, userID))
+	if err != nil {
+		return fmt.Errorf("create: app[%+v]: %w", app, err)
+	}
+
+	return web.Respond(ctx, w, toAppProduct(prd), http.StatusCreated)
+}
+
+// Query returns a list of products with paging, or streams all of them when
+// the client accepts CSV or NDJSON.
+func (h *Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	filter, err := parseFilter(r)
+	if err != nil {
+		return err
+	}
+
+	orderBy, err := parseOrder(r)
+	if err != nil {
+		return err
+	}
+
+	if contentType := web.StreamType(r); contentType != "" {
+		stream, err := web.NewStream(ctx, w, contentType, web.Columns(AppProduct{}))
+		if err != nil {
+			return err
+		}
+
+		err = h.product.Stream(ctx, filter, orderBy, func(prd product.Product) error {
+			return stream.Write(toAppProduct(prd))
+		})
+
+		return stream.Close(err)
+	}
+
+	page, err := paging.ParseRequest(r, orderBy, product.CheckSeek)
+	if err != nil {
+		return err
+	}
+
+	var prds []product.Product
+	if page.Cursor != nil {
+		prds, err = h.product.QuerySeek(ctx, filter, orderBy, page.Cursor.Seek, page.Limit())
+	} else {
+		prds, err = h.product.Query(ctx, filter, orderBy, page.Number, page.RowsPerPage)
+	}
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+
+	prds, cursors := paging.NewCursors(page, orderBy, prds, product.SeekAfter)
+
+	total, err := h.product.Count(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("count: %w", err)
+	}
+
+	return web.Respond(ctx, w, paging.NewResponse(r, toAppProducts(prds), total, page, cursors), http.StatusOK)
+}
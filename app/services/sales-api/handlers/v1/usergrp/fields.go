@@ -0,0 +1,39 @@
+package usergrp
+
+import (
+	"net/http"
+
+	"github.com/shawnzxx/service/business/core/user"
+	"github.com/shawnzxx/service/business/web/v1/fieldset"
+)
+
+var fieldNames = map[string]struct{}{
+	user.FieldID:          {},
+	user.FieldName:        {},
+	user.FieldEmail:       {},
+	user.FieldRoles:       {},
+	user.FieldDepartment:  {},
+	user.FieldEnabled:     {},
+	user.FieldMFAEnabled:  {},
+	user.FieldDateCreated: {},
+	user.FieldDateUpdated: {},
+}
+
+func parseFields(r *http.Request) ([]string, error) {
+	return fieldset.Parse(r, fieldNames)
+}
+
+// =============================================================================
+
+// Set of related resources that can be embedded in users.
+const (
+	includeProducts = "products"
+)
+
+var includeNames = map[string]struct{}{
+	includeProducts: {},
+}
+
+func parseInclude(r *http.Request) ([]string, error) {
+	return fieldset.ParseInclude(r, includeNames)
+}
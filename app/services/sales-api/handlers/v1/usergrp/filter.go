@@ -1,6 +1,9 @@
 package usergrp
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/mail"
 	"time"
@@ -8,20 +11,22 @@ import (
 	"github.com/google/uuid"
 	"github.com/shawnzxx/service/business/core/user"
 	"github.com/shawnzxx/service/business/cview/user/summary"
+	"github.com/shawnzxx/service/business/data/filter"
+	"github.com/shawnzxx/service/business/data/order"
 	"github.com/shawnzxx/service/business/sys/validate"
 )
 
 func parseFilter(r *http.Request) (user.QueryFilter, error) {
 	values := r.URL.Query()
 
-	var filter user.QueryFilter
+	var qf user.QueryFilter
 
 	if userID := values.Get("user_id"); userID != "" {
 		id, err := uuid.Parse(userID)
 		if err != nil {
 			return user.QueryFilter{}, validate.NewFieldsError("user_id", err)
 		}
-		filter.WithUserID(id)
+		qf.WithUserID(id)
 	}
 
 	if email := values.Get("email"); email != "" {
@@ -29,7 +34,7 @@ func parseFilter(r *http.Request) (user.QueryFilter, error) {
 		if err != nil {
 			return user.QueryFilter{}, validate.NewFieldsError("email", err)
 		}
-		filter.WithEmail(*addr)
+		qf.WithEmail(*addr)
 	}
 
 	if createdDate := values.Get("start_created_date"); createdDate != "" {
@@ -37,7 +42,7 @@ func parseFilter(r *http.Request) (user.QueryFilter, error) {
 		if err != nil {
 			return user.QueryFilter{}, validate.NewFieldsError("start_created_date", err)
 		}
-		filter.WithStartDateCreated(t)
+		qf.WithStartDateCreated(t)
 	}
 
 	if createdDate := values.Get("end_created_date"); createdDate != "" {
@@ -45,18 +50,82 @@ func parseFilter(r *http.Request) (user.QueryFilter, error) {
 		if err != nil {
 			return user.QueryFilter{}, validate.NewFieldsError("end_created_date", err)
 		}
-		filter.WithEndCreatedDate(t)
+		qf.WithEndCreatedDate(t)
 	}
 
 	if name := values.Get("name"); name != "" {
-		filter.WithName(name)
+		qf.WithName(name)
 	}
 
-	if err := filter.Validate(); err != nil {
+	// Keys like cost[gte] hold conditions compared with an operator.
+	conds, err := filter.Parse(r, user.FilterFields)
+	if err != nil {
 		return user.QueryFilter{}, err
 	}
+	qf.WithConditions(conds)
 
-	return filter, nil
+	if err := qf.Validate(); err != nil {
+		return user.QueryFilter{}, err
+	}
+
+	return qf, nil
+}
+
+// Set of fields of a user the filters and orders compare, which are the
+// fields the redaction policy names.
+var (
+	filterByFields = map[string]string{
+		user.FilterByID:          user.FieldID,
+		user.FilterByName:        user.FieldName,
+		user.FilterByEmail:       user.FieldEmail,
+		user.FilterByRoles:       user.FieldRoles,
+		user.FilterByDepartment:  user.FieldDepartment,
+		user.FilterByEnabled:     user.FieldEnabled,
+		user.FilterByDateCreated: user.FieldDateCreated,
+	}
+
+	orderByFieldNames = map[string]string{
+		user.OrderByID:         user.FieldID,
+		user.OrderByName:       user.FieldName,
+		user.OrderByEmail:      user.FieldEmail,
+		user.OrderByRoles:      user.FieldRoles,
+		user.OrderByEnabled:    user.FieldEnabled,
+		user.OrderByDepartment: user.FieldDepartment,
+	}
+)
+
+// checkRedacted rejects filters and orders on the fields redacted from the
+// users the caller doesn't own. Which users come back, and in what order,
+// would otherwise give the hidden values away a character at a time.
+func (h *Handlers) checkRedacted(ctx context.Context, qf user.QueryFilter, orderBy []order.By) error {
+	redactions, err := h.redact.Unowned(ctx)
+	if err != nil {
+		return fmt.Errorf("unowned: %w", err)
+	}
+
+	if len(redactions) == 0 {
+		return nil
+	}
+
+	errHidden := errors.New("can't be used on a field you aren't allowed to see")
+
+	if _, exists := redactions[user.FieldEmail]; exists && qf.Email != nil {
+		return validate.NewFieldsError("email", errHidden)
+	}
+
+	for _, cond := range qf.Conditions {
+		if _, exists := redactions[filterByFields[cond.Field]]; exists {
+			return validate.NewFieldsError(cond.Field+"["+cond.Operator+"]", errHidden)
+		}
+	}
+
+	for _, ob := range orderBy {
+		if _, exists := redactions[orderByFieldNames[ob.Field]]; exists {
+			return validate.NewFieldsError("orderBy", errHidden)
+		}
+	}
+
+	return nil
 }
 
 // =============================================================================
@@ -64,19 +133,19 @@ func parseFilter(r *http.Request) (user.QueryFilter, error) {
 func parseSummaryFilter(r *http.Request) (summary.QueryFilter, error) {
 	values := r.URL.Query()
 
-	var filter summary.QueryFilter
+	var qf summary.QueryFilter
 
 	if userID := values.Get("user_id"); userID != "" {
 		id, err := uuid.Parse(userID)
 		if err != nil {
 			return summary.QueryFilter{}, validate.NewFieldsError("user_id", err)
 		}
-		filter.WithUserID(id)
+		qf.WithUserID(id)
 	}
 
 	if userName := values.Get("user_name"); userName != "" {
-		filter.WithUserName(userName)
+		qf.WithUserName(userName)
 	}
 
-	return filter, nil
+	return qf, nil
 }
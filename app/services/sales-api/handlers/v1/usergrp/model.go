@@ -5,6 +5,7 @@ import (
 	"net/mail"
 	"time"
 
+	"github.com/shawnzxx/service/business/core/product"
 	"github.com/shawnzxx/service/business/core/user"
 	"github.com/shawnzxx/service/business/cview/user/summary"
 	"github.com/shawnzxx/service/business/sys/validate"
@@ -19,6 +20,7 @@ type AppUser struct {
 	PasswordHash []byte   `json:"-"`
 	Department   string   `json:"department"`
 	Enabled      bool     `json:"enabled"`
+	MFAEnabled   bool     `json:"mfaEnabled"`
 	DateCreated  string   `json:"dateCreated"`
 	DateUpdated  string   `json:"dateUpdated"`
 }
@@ -37,11 +39,41 @@ func toAppUser(usr user.User) AppUser {
 		PasswordHash: usr.PasswordHash,
 		Department:   usr.Department,
 		Enabled:      usr.Enabled,
+		MFAEnabled:   usr.MFA.Enabled,
 		DateCreated:  usr.DateCreated.Format(time.RFC3339),
 		DateUpdated:  usr.DateUpdated.Format(time.RFC3339),
 	}
 }
 
+func toAppUsers(users []user.User) []AppUser {
+	items := make([]AppUser, len(users))
+	for i, usr := range users {
+		items[i] = toAppUser(usr)
+	}
+	return items
+}
+
+// AppUserProduct represents a product embedded in the user it belongs to.
+type AppUserProduct struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Cost        float64 `json:"cost"`
+	Quantity    int     `json:"quantity"`
+	DateCreated string  `json:"dateCreated"`
+	DateUpdated string  `json:"dateUpdated"`
+}
+
+func toAppUserProduct(prd product.Product) AppUserProduct {
+	return AppUserProduct{
+		ID:          prd.ID.String(),
+		Name:        prd.Name,
+		Cost:        prd.Cost,
+		Quantity:    prd.Quantity,
+		DateCreated: prd.DateCreated.Format(time.RFC3339),
+		DateUpdated: prd.DateUpdated.Format(time.RFC3339),
+	}
+}
+
 // =============================================================================
 
 // AppNewUser contains information needed to create a new user.
@@ -163,3 +195,69 @@ func toAppSummary(smm summary.Summary) AppSummary {
 		TotalCost:  smm.TotalCost,
 	}
 }
+
+// =============================================================================
+
+// AppToken represents a token issued to a client.
+type AppToken struct {
+	Token     string `json:"token"`
+	ExpiresIn int    `json:"expiresIn"`
+}
+
+func toAppToken(token string, ttl time.Duration) AppToken {
+	return AppToken{
+		Token:     token,
+		ExpiresIn: int(ttl.Seconds()),
+	}
+}
+
+// AppChallenge is returned in place of a token when the user must complete a
+// second authentication step.
+type AppChallenge struct {
+	MFARequired bool   `json:"mfaRequired"`
+	Token       string `json:"mfaToken"`
+	ExpiresIn   int    `json:"expiresIn"`
+}
+
+func toAppChallenge(token string, ttl time.Duration) AppChallenge {
+	return AppChallenge{
+		MFARequired: true,
+		Token:       token,
+		ExpiresIn:   int(ttl.Seconds()),
+	}
+}
+
+// =============================================================================
+
+// AppMFACode contains a one-time code from an authenticator app or a
+// recovery code.
+type AppMFACode struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// Validate checks the data in the model is considered clean.
+func (app AppMFACode) Validate() error {
+	if err := validate.Check(app); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AppMFAEnrollment contains what a client needs to add the account to an
+// authenticator app.
+type AppMFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func toAppMFAEnrollment(enr user.MFAEnrollment) AppMFAEnrollment {
+	return AppMFAEnrollment{
+		Secret: enr.Secret,
+		URI:    enr.URI,
+	}
+}
+
+// AppRecoveryCodes contains the recovery codes issued when MFA is enabled.
+type AppRecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
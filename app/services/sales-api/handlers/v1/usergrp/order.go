@@ -11,21 +11,24 @@ import (
 )
 
 var orderByFields = map[string]struct{}{
-	user.OrderByID:      {},
-	user.OrderByName:    {},
-	user.OrderByEmail:   {},
-	user.OrderByRoles:   {},
-	user.OrderByEnabled: {},
+	user.OrderByID:         {},
+	user.OrderByName:       {},
+	user.OrderByEmail:      {},
+	user.OrderByRoles:      {},
+	user.OrderByEnabled:    {},
+	user.OrderByDepartment: {},
 }
 
-func parseOrder(r *http.Request) (order.By, error) {
+func parseOrder(r *http.Request) ([]order.By, error) {
 	orderBy, err := order.Parse(r, user.DefaultOrderBy)
 	if err != nil {
-		return order.By{}, err
+		return nil, err
 	}
 
-	if _, exists := orderByFields[orderBy.Field]; !exists {
-		return order.By{}, validate.NewFieldsError(orderBy.Field, errors.New("order field does not exist"))
+	for _, ob := range orderBy {
+		if _, exists := orderByFields[ob.Field]; !exists {
+			return nil, validate.NewFieldsError(ob.Field, errors.New("order field does not exist"))
+		}
 	}
 
 	return orderBy, nil
@@ -38,14 +41,16 @@ var orderBySummaryFields = map[string]struct{}{
 	summary.OrderByUserName: {},
 }
 
-func parseSummaryOrder(r *http.Request) (order.By, error) {
-	orderBy, err := order.Parse(r, user.DefaultOrderBy)
+func parseSummaryOrder(r *http.Request) ([]order.By, error) {
+	orderBy, err := order.Parse(r, summary.DefaultOrderBy)
 	if err != nil {
-		return order.By{}, err
+		return nil, err
 	}
 
-	if _, exists := orderBySummaryFields[orderBy.Field]; !exists {
-		return order.By{}, validate.NewFieldsError(orderBy.Field, errors.New("order field does not exist"))
+	for _, ob := range orderBy {
+		if _, exists := orderBySummaryFields[ob.Field]; !exists {
+			return nil, validate.NewFieldsError(ob.Field, errors.New("order field does not exist"))
+		}
 	}
 
 	return orderBy, nil
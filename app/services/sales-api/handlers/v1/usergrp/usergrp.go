@@ -6,22 +6,51 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/mail"
+	"slices"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/shawnzxx/service/business/core/product"
 	"github.com/shawnzxx/service/business/core/user"
+	"github.com/shawnzxx/service/business/cview/user/summary"
+	"github.com/shawnzxx/service/business/sys/validate"
+	"github.com/shawnzxx/service/business/web/auth"
 	v1 "github.com/shawnzxx/service/business/web/v1"
+	"github.com/shawnzxx/service/business/web/v1/fieldset"
 	"github.com/shawnzxx/service/business/web/v1/paging"
+	"github.com/shawnzxx/service/business/web/v1/redact"
 	"github.com/shawnzxx/service/foundation/web"
 )
 
+// Set of lifetimes for the tokens issued by these handlers.
+const (
+	tokenTTL         = time.Hour
+	challengeTTL     = 5 * time.Minute
+	impersonationTTL = 15 * time.Minute
+)
+
+// mfaIssuer is the name authenticator apps show for enrolled accounts.
+const mfaIssuer = "Sales API"
+
 // Handlers manages the set of user endpoints.
 type Handlers struct {
-	user *user.Core
+	user    *user.Core
+	summary *summary.Core
+	product *product.Core
+	auth    *auth.Auth
+	redact  *redact.Filter
 }
 
-// New constructs a handlers for route access.
-func New(user *user.Core) *Handlers {
+// New constructs a handlers for route access. The products are embedded in
+// users when asked for.
+func New(user *user.Core, summary *summary.Core, product *product.Core, a *auth.Auth) *Handlers {
 	return &Handlers{
-		user: user,
+		user:    user,
+		summary: summary,
+		product: product,
+		auth:    a,
+		redact:  redact.New(a, auth.RuleRedactUser),
 	}
 }
 
@@ -51,65 +80,100 @@ func (h *Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Re
 }
 
 // Update updates a user in the system.
-// func (h *Handlers) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-// 	var app AppUpdateUser
-// 	if err := web.Decode(r, &app); err != nil {
-// 		return err
-// 	}
-
-// 	userID := auth.GetUserID(ctx)
-
-// 	usr, err := h.user.QueryByID(ctx, userID)
-// 	if err != nil {
-// 		switch {
-// 		case errors.Is(err, user.ErrNotFound):
-// 			return v1.NewRequestError(err, http.StatusNotFound)
-// 		default:
-// 			return fmt.Errorf("querybyid: userID[%s]: %w", userID, err)
-// 		}
-// 	}
-
-// 	uu, err := toCoreUpdateUser(app)
-// 	if err != nil {
-// 		return v1.NewRequestError(err, http.StatusBadRequest)
-// 	}
-
-// 	usr, err = h.user.Update(ctx, usr, uu)
-// 	if err != nil {
-// 		return fmt.Errorf("update: userID[%s] uu[%+v]: %w", userID, uu, err)
-// 	}
-
-// 	return web.Respond(ctx, w, toAppUser(usr), http.StatusOK)
-// }
-
-// Delete removes a user from the system.
-// func (h *Handlers) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-// 	userID := auth.GetUserID(ctx)
-
-// 	usr, err := h.user.QueryByID(ctx, userID)
-// 	if err != nil {
-// 		switch {
-// 		case errors.Is(err, user.ErrNotFound):
-// 			return web.Respond(ctx, w, nil, http.StatusNoContent)
-// 		default:
-// 			return fmt.Errorf("querybyid: userID[%s]: %w", userID, err)
-// 		}
-// 	}
-
-// 	if err := h.user.Delete(ctx, usr); err != nil {
-// 		return fmt.Errorf("delete: userID[%s]: %w", userID, err)
-// 	}
-
-// 	return web.Respond(ctx, w, nil, http.StatusNoContent)
-// }
-
-// Query returns a list of users with paging.
-func (h *Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	page, err := paging.ParseRequest(r)
-	if err != nil {
+func (h *Handlers) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var app AppUpdateUser
+	if err := web.Decode(r, &app); err != nil {
 		return err
 	}
 
+	// A password change made with an impersonation token would lock the
+	// real user out of their own account.
+	if app.Password != nil && auth.GetClaims(ctx).Impersonated() {
+		return v1.NewRequestError(auth.ErrImpersonating, http.StatusForbidden)
+	}
+
+	userID, err := uuid.Parse(web.Param(r, "user_id"))
+	if err != nil {
+		return validate.NewFieldsError("user_id", err)
+	}
+
+	usr, err := h.user.QueryByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return v1.NewRequestError(err, http.StatusNotFound)
+		default:
+			return fmt.Errorf("querybyid: userID[%s]: %w", userID, err)
+		}
+	}
+
+	if !web.IfMatch(r, web.ETag(usr.Version)) {
+		return v1.NewRequestError(user.ErrVersionConflict, http.StatusPreconditionFailed)
+	}
+
+	uu, err := toCoreUpdateUser(app)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	usr, err = h.user.Update(ctx, usr, uu)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrUniqueEmail):
+			return v1.NewRequestError(err, http.StatusConflict)
+		case errors.Is(err, user.ErrVersionConflict):
+			return v1.NewRequestError(user.ErrVersionConflict, http.StatusPreconditionFailed)
+		}
+		return fmt.Errorf("update: userID[%s] uu[%+v]: %w", userID, uu, err)
+	}
+
+	doc, err := h.redact.Value(ctx, usr.ID.String(), toAppUser(usr))
+	if err != nil {
+		return fmt.Errorf("redact: userID[%s]: %w", userID, err)
+	}
+
+	w.Header().Add("Vary", "Authorization")
+	web.SetETag(w, web.ETagVariant(usr.Version, doc.Variant()))
+
+	return web.Respond(ctx, w, doc, http.StatusOK)
+}
+
+// Delete removes a user from the system. Deleting a user that doesn't exist
+// succeeds, since the outcome is the same.
+func (h *Handlers) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	userID, err := uuid.Parse(web.Param(r, "user_id"))
+	if err != nil {
+		return validate.NewFieldsError("user_id", err)
+	}
+
+	usr, err := h.user.QueryByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return web.Respond(ctx, w, nil, http.StatusNoContent)
+		default:
+			return fmt.Errorf("querybyid: userID[%s]: %w", userID, err)
+		}
+	}
+
+	if !web.IfMatch(r, web.ETag(usr.Version)) {
+		return v1.NewRequestError(user.ErrVersionConflict, http.StatusPreconditionFailed)
+	}
+
+	if err := h.user.Delete(ctx, usr); err != nil {
+		if errors.Is(err, user.ErrVersionConflict) {
+			return v1.NewRequestError(user.ErrVersionConflict, http.StatusPreconditionFailed)
+		}
+		return fmt.Errorf("delete: userID[%s]: %w", userID, err)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// Query returns a list of users with paging, or streams all of them when the
+// client accepts CSV or NDJSON. Only the fields asked for are returned, and
+// the products of the users on the page are embedded when asked for.
+func (h *Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	filter, err := parseFilter(r)
 	if err != nil {
 		return err
@@ -120,14 +184,74 @@ func (h *Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return err
 	}
 
-	users, err := h.user.Query(ctx, filter, orderBy, page.Number, page.RowsPerPage)
+	if err := h.checkRedacted(ctx, filter, orderBy); err != nil {
+		return err
+	}
+
+	fields, err := parseFields(r)
+	if err != nil {
+		return err
+	}
+
+	include, err := parseInclude(r)
+	if err != nil {
+		return err
+	}
+
+	// Exports aren't paged, every matching user is streamed.
+	if contentType := web.StreamType(r); contentType != "" {
+		if len(include) > 0 {
+			return validate.NewFieldsError("include", errors.New("can't be used with exports"))
+		}
+
+		stream, err := web.NewStream(ctx, w, contentType, fieldset.Columns(web.Columns(AppUser{}), fields))
+		if err != nil {
+			return err
+		}
+
+		err = h.user.Stream(ctx, filter, fields, orderBy, func(usr user.User) error {
+			doc, err := h.redact.Value(ctx, usr.ID.String(), toAppUser(usr))
+			if err != nil {
+				return fmt.Errorf("redact: %w", err)
+			}
+			return stream.Write(doc.Select(fields))
+		})
+
+		return stream.Close(err)
+	}
+
+	page, err := paging.ParseRequest(r, orderBy, user.CheckSeek)
+	if err != nil {
+		return err
+	}
+
+	var users []user.User
+	if page.Cursor != nil {
+		users, err = h.user.QuerySeek(ctx, filter, fields, orderBy, page.Cursor.Seek, page.Limit())
+	} else {
+		users, err = h.user.Query(ctx, filter, fields, orderBy, page.Number, page.RowsPerPage)
+	}
 	if err != nil {
 		return fmt.Errorf("query: %w", err)
 	}
 
-	items := make([]AppUser, len(users))
-	for i, usr := range users {
-		items[i] = toAppUser(usr)
+	users, cursors := paging.NewCursors(page, orderBy, users, user.SeekAfter)
+
+	items, err := redact.Slice(ctx, h.redact, toAppUsers(users), func(app AppUser) string {
+		return app.ID
+	})
+	if err != nil {
+		return fmt.Errorf("redact: %w", err)
+	}
+
+	for i := range items {
+		items[i] = items[i].Select(fields)
+	}
+
+	if slices.Contains(include, includeProducts) {
+		if err := h.embedProducts(ctx, users, items); err != nil {
+			return err
+		}
 	}
 
 	total, err := h.user.Count(ctx, filter)
@@ -135,22 +259,318 @@ func (h *Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return fmt.Errorf("count: %w", err)
 	}
 
-	return web.Respond(ctx, w, paging.NewResponse(items, total, page.Number, page.RowsPerPage), http.StatusOK)
+	return web.Respond(ctx, w, paging.NewResponse(r, items, total, page, cursors), http.StatusOK)
+}
+
+// embedProducts adds the products of each user to the document of the
+// user. The products of all the users are loaded at once.
+func (h *Handlers) embedProducts(ctx context.Context, users []user.User, docs []redact.Document) error {
+	userIDs := make([]uuid.UUID, len(users))
+	for i, usr := range users {
+		userIDs[i] = usr.ID
+	}
+
+	prds, err := h.product.QueryByUserIDs(ctx, userIDs)
+	if err != nil {
+		return fmt.Errorf("querybyuserids: %w", err)
+	}
+
+	byUser := make(map[uuid.UUID][]AppUserProduct, len(users))
+	for _, prd := range prds {
+		byUser[prd.UserID] = append(byUser[prd.UserID], toAppUserProduct(prd))
+	}
+
+	for i, usr := range users {
+		items := byUser[usr.ID]
+		if items == nil {
+			items = []AppUserProduct{}
+		}
+		docs[i] = docs[i].With(includeProducts, items)
+	}
+
+	return nil
+}
+
+// QuerySummary returns a list of user summaries with paging, or streams all
+// of them when the client accepts CSV or NDJSON.
+func (h *Handlers) QuerySummary(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	filter, err := parseSummaryFilter(r)
+	if err != nil {
+		return err
+	}
+
+	orderBy, err := parseSummaryOrder(r)
+	if err != nil {
+		return err
+	}
+
+	if contentType := web.StreamType(r); contentType != "" {
+		stream, err := web.NewStream(ctx, w, contentType, web.Columns(AppSummary{}))
+		if err != nil {
+			return err
+		}
+
+		err = h.summary.Stream(ctx, filter, orderBy, func(smm summary.Summary) error {
+			return stream.Write(toAppSummary(smm))
+		})
+
+		return stream.Close(err)
+	}
+
+	page, err := paging.ParseRequest(r, orderBy, summary.CheckSeek)
+	if err != nil {
+		return err
+	}
+
+	var smms []summary.Summary
+	if page.Cursor != nil {
+		smms, err = h.summary.QuerySeek(ctx, filter, orderBy, page.Cursor.Seek, page.Limit())
+	} else {
+		smms, err = h.summary.Query(ctx, filter, orderBy, page.Number, page.RowsPerPage)
+	}
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+
+	smms, cursors := paging.NewCursors(page, orderBy, smms, summary.SeekAfter)
+
+	items := make([]AppSummary, len(smms))
+	for i, smm := range smms {
+		items[i] = toAppSummary(smm)
+	}
+
+	total, err := h.summary.Count(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("count: %w", err)
+	}
+
+	return web.Respond(ctx, w, paging.NewResponse(r, items, total, page, cursors), http.StatusOK)
 }
 
 // QueryByID returns a user by its ID.
-// func (h *Handlers) QueryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-// 	id := auth.GetUserID(ctx)
-
-// 	usr, err := h.user.QueryByID(ctx, id)
-// 	if err != nil {
-// 		switch {
-// 		case errors.Is(err, user.ErrNotFound):
-// 			return v1.NewRequestError(err, http.StatusNotFound)
-// 		default:
-// 			return fmt.Errorf("querybyid: id[%s]: %w", id, err)
-// 		}
-// 	}
-
-// 	return web.Respond(ctx, w, toAppUser(usr), http.StatusOK)
-// }
+func (h *Handlers) QueryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := uuid.Parse(web.Param(r, "user_id"))
+	if err != nil {
+		return validate.NewFieldsError("user_id", err)
+	}
+
+	usr, err := h.user.QueryByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return v1.NewRequestError(err, http.StatusNotFound)
+		default:
+			return fmt.Errorf("querybyid: id[%s]: %w", id, err)
+		}
+	}
+
+	doc, err := h.redact.Value(ctx, usr.ID.String(), toAppUser(usr))
+	if err != nil {
+		return fmt.Errorf("redact: id[%s]: %w", id, err)
+	}
+
+	// The fields redacted depend on the caller, so the tag identifies the
+	// representation rather than only the version of the user.
+	etag := web.ETagVariant(usr.Version, doc.Variant())
+	w.Header().Add("Vary", "Authorization")
+	web.SetETag(w, etag)
+
+	if web.IfNoneMatch(r, etag) {
+		return web.Respond(ctx, w, nil, http.StatusNotModified)
+	}
+
+	return web.Respond(ctx, w, doc, http.StatusOK)
+}
+
+// Impersonate issues a short-lived token that lets the calling admin act as
+// the specified user.
+func (h *Handlers) Impersonate(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	userID, err := uuid.Parse(web.Param(r, "user_id"))
+	if err != nil {
+		return validate.NewFieldsError("user_id", err)
+	}
+
+	usr, err := h.user.QueryByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return v1.NewRequestError(err, http.StatusNotFound)
+		default:
+			return fmt.Errorf("querybyid: userID[%s]: %w", userID, err)
+		}
+	}
+
+	if !usr.Enabled {
+		return v1.NewRequestError(errors.New("user is disabled"), http.StatusBadRequest)
+	}
+
+	token, err := h.auth.Impersonate(auth.GetClaims(ctx), usr, impersonationTTL)
+	if err != nil {
+		if errors.Is(err, auth.ErrImpersonating) || errors.Is(err, auth.ErrImpersonation) {
+			return v1.NewRequestError(err, http.StatusForbidden)
+		}
+		return fmt.Errorf("impersonate: userID[%s]: %w", userID, err)
+	}
+
+	return web.Respond(ctx, w, toAppToken(token, impersonationTTL), http.StatusOK)
+}
+
+// Token provides an API token for the authenticated user. Users with
+// multi-factor authentication enabled receive a challenge token instead,
+// which must be exchanged through TokenMFA.
+func (h *Handlers) Token(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	email, pass, ok := r.BasicAuth()
+	if !ok {
+		return auth.NewAuthError("must provide email and password in Basic auth")
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return auth.NewAuthError("invalid email format")
+	}
+
+	usr, err := h.user.Authenticate(ctx, *addr, pass)
+	if err != nil {
+		switch {
+		// An unknown email fails like a wrong password, so the response
+		// doesn't tell which emails have accounts.
+		case errors.Is(err, user.ErrNotFound), errors.Is(err, user.ErrAuthenticationFailure):
+			return auth.NewAuthError("%w", user.ErrAuthenticationFailure)
+		default:
+			return fmt.Errorf("authenticate: %w", err)
+		}
+	}
+
+	if !usr.Enabled {
+		return auth.NewAuthError("user is disabled")
+	}
+
+	amr := []string{auth.AMRPassword}
+
+	if usr.MFA.Enabled {
+		token, err := h.auth.Challenge(usr, amr, challengeTTL)
+		if err != nil {
+			return fmt.Errorf("challenge: userID[%s]: %w", usr.ID, err)
+		}
+
+		return web.Respond(ctx, w, toAppChallenge(token, challengeTTL), http.StatusOK)
+	}
+
+	token, err := h.auth.Token(usr, amr, tokenTTL)
+	if err != nil {
+		return fmt.Errorf("token: userID[%s]: %w", usr.ID, err)
+	}
+
+	return web.Respond(ctx, w, toAppToken(token, tokenTTL), http.StatusOK)
+}
+
+// TokenMFA exchanges a challenge token and a one-time code for an API token.
+func (h *Handlers) TokenMFA(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var app AppMFACode
+	if err := web.Decode(r, &app); err != nil {
+		return err
+	}
+
+	usr, err := h.claimsUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	recovery, err := h.user.VerifyMFA(ctx, usr, app.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrMFAInvalidCode), errors.Is(err, user.ErrMFANotEnrolled):
+			return auth.NewAuthError("%w", err)
+		default:
+			return fmt.Errorf("verifymfa: userID[%s]: %w", usr.ID, err)
+		}
+	}
+
+	method := auth.AMROTP
+	if recovery {
+		method = auth.AMRMFA
+	}
+	amr := append(auth.GetClaims(ctx).AMR, method)
+
+	token, err := h.auth.Token(usr, amr, tokenTTL)
+	if err != nil {
+		return fmt.Errorf("token: userID[%s]: %w", usr.ID, err)
+	}
+
+	return web.Respond(ctx, w, toAppToken(token, tokenTTL), http.StatusOK)
+}
+
+// EnrollMFA starts multi-factor enrolment for the authenticated user. The
+// response contains the provisioning URI to render as a QR code.
+func (h *Handlers) EnrollMFA(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if auth.GetClaims(ctx).Impersonated() {
+		return v1.NewRequestError(auth.ErrImpersonating, http.StatusForbidden)
+	}
+
+	usr, err := h.claimsUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	enr, err := h.user.EnrollMFA(ctx, usr, mfaIssuer)
+	if err != nil {
+		if errors.Is(err, user.ErrMFAEnabled) {
+			return v1.NewRequestError(err, http.StatusConflict)
+		}
+		return fmt.Errorf("enrollmfa: userID[%s]: %w", usr.ID, err)
+	}
+
+	return web.Respond(ctx, w, toAppMFAEnrollment(enr), http.StatusOK)
+}
+
+// ConfirmMFA completes multi-factor enrolment with a code from the
+// authenticator app and returns the recovery codes.
+func (h *Handlers) ConfirmMFA(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if auth.GetClaims(ctx).Impersonated() {
+		return v1.NewRequestError(auth.ErrImpersonating, http.StatusForbidden)
+	}
+
+	var app AppMFACode
+	if err := web.Decode(r, &app); err != nil {
+		return err
+	}
+
+	usr, err := h.claimsUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	codes, err := h.user.ConfirmMFA(ctx, usr, app.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrMFAEnabled):
+			return v1.NewRequestError(err, http.StatusConflict)
+		case errors.Is(err, user.ErrMFANotEnrolled), errors.Is(err, user.ErrMFAInvalidCode):
+			return v1.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return fmt.Errorf("confirmmfa: userID[%s]: %w", usr.ID, err)
+		}
+	}
+
+	return web.Respond(ctx, w, AppRecoveryCodes{Codes: codes}, http.StatusOK)
+}
+
+// claimsUser returns the user the claims in the context were issued to.
+func (h *Handlers) claimsUser(ctx context.Context) (user.User, error) {
+	userID, err := auth.GetUserID(ctx)
+	if err != nil {
+		return user.User{}, auth.NewAuthError("invalid subject: %s", err)
+	}
+
+	usr, err := h.user.QueryByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return user.User{}, auth.NewAuthError("user not found")
+		default:
+			return user.User{}, fmt.Errorf("querybyid: userID[%s]: %w", userID, err)
+		}
+	}
+
+	return usr, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	database "github.com/shawnzxx/service/business/sys/database/pgx"
@@ -14,10 +15,27 @@ import (
 
 	"github.com/ardanlabs/conf/v3"
 	"github.com/shawnzxx/service/app/services/sales-api/handlers"
+	"github.com/shawnzxx/service/business/core/event"
+	"github.com/shawnzxx/service/business/core/user"
+	"github.com/shawnzxx/service/business/sys/password"
 	"github.com/shawnzxx/service/business/web/auth"
+	"github.com/shawnzxx/service/business/web/idempotency"
+	"github.com/shawnzxx/service/business/web/loadshed"
+	"github.com/shawnzxx/service/business/web/metrics"
+	"github.com/shawnzxx/service/business/web/ratelimit"
 	"github.com/shawnzxx/service/business/web/v1/debug"
+	"github.com/shawnzxx/service/business/web/v1/mid"
 	"github.com/shawnzxx/service/foundation/keystore"
 	"github.com/shawnzxx/service/foundation/logger"
+	"github.com/shawnzxx/service/foundation/otlp"
+	"github.com/shawnzxx/service/foundation/shutdown"
+	"github.com/shawnzxx/service/foundation/tlsconfig"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.uber.org/zap"
 )
 
@@ -54,9 +72,22 @@ func run(log *zap.SugaredLogger) error {
 			WriteTimeout    time.Duration `conf:"default:10s"`
 			IdleTimeout     time.Duration `conf:"default:120s"`
 			ShutdownTimeout time.Duration `conf:"default:20s,mask"`
+			PhaseTimeout    time.Duration `conf:"default:5s"`
+			PreStopDelay    time.Duration `conf:"default:10s"`
 			APIHost         string        `conf:"default:0.0.0.0:3000"`
 			DebugHost       string        `conf:"default:0.0.0.0:4000"`
 		}
+		TLS struct {
+			CertFile        string
+			KeyFile         string
+			ClientCAFile    string
+			ClientAuth      string        `conf:"default:none,help:none|optional|require"`
+			DebugClientAuth string        `conf:"default:none,help:none|optional|require"`
+			MinVersion      string        `conf:"default:1.2,help:1.2|1.3"`
+			CipherSuites    []string      `conf:"help:TLS 1.2 cipher suites or Go's defaults when empty"`
+			ReloadInterval  time.Duration `conf:"default:1m"`
+			ClientRoles     []string      `conf:"help:roles of client certificate identities as identity=ROLE|ROLE"`
+		}
 		DB struct {
 			User         string `conf:"default:postgres"`
 			Password     string `conf:"default:postgres,mask"`
@@ -67,9 +98,60 @@ func run(log *zap.SugaredLogger) error {
 			DisableTLS   bool   `conf:"default:true"`
 		}
 		Auth struct {
-			KeysFolder string `conf:"default:zarf/keys/"`
-			ActiveKID  string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
-			Issuer     string `conf:"default:service project"`
+			KeysFolder  string `conf:"default:zarf/keys/"`
+			ActiveKID   string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
+			Issuer      string `conf:"default:service project"`
+			MFARequired bool   `conf:"default:false"`
+		}
+		Password struct {
+			Argon2Memory      uint32 `conf:"default:65536"`
+			Argon2Iterations  uint32 `conf:"default:3"`
+			Argon2Parallelism uint8  `conf:"default:2"`
+			Argon2SaltLength  uint32 `conf:"default:16"`
+			Argon2KeyLength   uint32 `conf:"default:32"`
+		}
+		CORS struct {
+			AllowedOrigins   []string      `conf:"default:*"`
+			AllowedMethods   []string      `conf:"default:GET;POST;PUT;PATCH;DELETE"`
+			AllowedHeaders   []string      `conf:"default:Accept;Authorization;Content-Type;Idempotency-Key;If-Match;If-None-Match;Last-Event-ID"`
+			ExposedHeaders   []string      `conf:"default:ETag;Idempotent-Replayed;RateLimit-Limit;RateLimit-Remaining;RateLimit-Reset;Retry-After;X-Trace-ID;X-Request-ID"`
+			AllowCredentials bool          `conf:"default:false"`
+			MaxAge           time.Duration `conf:"default:24h"`
+		}
+		RateLimit struct {
+			Window         time.Duration `conf:"default:1m"`
+			Requests       int           `conf:"default:100"`
+			AdminRequests  int           `conf:"default:1000"`
+			TokenRequests  int           `conf:"default:10"`
+			TrustedProxies []string
+		}
+		Compress struct {
+			MinSize      int      `conf:"default:1024"`
+			ContentTypes []string `conf:"default:application/json;application/problem+json;application/x-ndjson;text/csv;text/plain"`
+		}
+		Deadline struct {
+			Default time.Duration `conf:"default:5s"`
+			Export  time.Duration `conf:"default:5m"`
+		}
+		LoadShed struct {
+			InitialLimit int     `conf:"default:100"`
+			MinLimit     int     `conf:"default:10"`
+			MaxLimit     int     `conf:"default:1000"`
+			Tolerance    float64 `conf:"default:2"`
+			Smoothing    float64 `conf:"default:0.2"`
+		}
+		Idempotency struct {
+			TTL time.Duration `conf:"default:24h"`
+		}
+		Events struct {
+			Buffer    int           `conf:"default:1000"`
+			Heartbeat time.Duration `conf:"default:15s"`
+		}
+		Tempo struct {
+			Exporter    string  `conf:"default:none,help:none|stdout|otlp"`
+			Endpoint    string  `conf:"default:http://tempo.sales-system.svc.cluster.local:4318"`
+			ServiceName string  `conf:"default:sales-api"`
+			Probability float64 `conf:"default:0.05"`
 		}
 	}{
 		Version: conf.Version{
@@ -100,6 +182,19 @@ func run(log *zap.SugaredLogger) error {
 	}
 	log.Infow("startup", "config", out)
 
+	// -------------------------------------------------------------------------
+	// Shutdown Support
+
+	// Everything started from here adds a phase to the coordinator, which
+	// stops it in the reverse order when the service shuts down.
+	coord := shutdown.New(shutdown.Config{
+		Log:          log,
+		PreStopDelay: cfg.Web.PreStopDelay,
+		Timeout:      cfg.Web.ShutdownTimeout,
+		PhaseTimeout: cfg.Web.PhaseTimeout,
+	})
+	defer coord.Stop()
+
 	// -------------------------------------------------------------------------
 	// Database Support
 
@@ -117,10 +212,13 @@ func run(log *zap.SugaredLogger) error {
 	if err != nil {
 		return fmt.Errorf("connecting to db: %w", err)
 	}
-	defer func() {
-		log.Infow("shutdown", "status", "stopping database support", "host", cfg.DB.Host)
-		db.Close()
-	}()
+	coord.Add("database", func(ctx context.Context) error {
+		return db.Close()
+	})
+
+	if err := metrics.RegisterDB(db.DB, cfg.DB.Name); err != nil {
+		return fmt.Errorf("registering db metrics: %w", err)
+	}
 
 	// -------------------------------------------------------------------------
 	// Initialize authentication support
@@ -133,9 +231,18 @@ func run(log *zap.SugaredLogger) error {
 		return fmt.Errorf("reading keys: %w", err)
 	}
 
+	clientRoles, err := auth.ParseClientRoles(cfg.TLS.ClientRoles)
+	if err != nil {
+		return fmt.Errorf("parsing client roles: %w", err)
+	}
+
 	authCfg := auth.Config{
-		Log:       log,
-		KeyLookup: ks,
+		Log:         log,
+		KeyLookup:   ks,
+		Issuer:      cfg.Auth.Issuer,
+		ActiveKID:   cfg.Auth.ActiveKID,
+		MFARequired: cfg.Auth.MFARequired,
+		ClientRoles: clientRoles,
 	}
 
 	authCong, err := auth.New(authCfg)
@@ -143,17 +250,170 @@ func run(log *zap.SugaredLogger) error {
 		return fmt.Errorf("constructing authCong: %w", err)
 	}
 
+	// -------------------------------------------------------------------------
+	// Initialize password hashing support
+
+	log.Infow("startup", "status", "initializing password hashing support")
+
+	argon2id, err := password.NewArgon2id(password.Argon2idParams{
+		Memory:      cfg.Password.Argon2Memory,
+		Iterations:  cfg.Password.Argon2Iterations,
+		Parallelism: cfg.Password.Argon2Parallelism,
+		SaltLength:  cfg.Password.Argon2SaltLength,
+		KeyLength:   cfg.Password.Argon2KeyLength,
+	})
+	if err != nil {
+		return fmt.Errorf("constructing argon2id: %w", err)
+	}
+
+	// Bcrypt is only used to verify hashes created before Argon2id became
+	// the default. Those hashes are upgraded on the next successful login.
+	hasher := password.New(argon2id, password.NewBcrypt())
+
+	// -------------------------------------------------------------------------
+	// Initialize rate limiting support
+
+	log.Infow("startup", "status", "initializing rate limiting support")
+
+	limiter, err := ratelimit.New(ratelimit.Config{
+		Log:            log,
+		Store:          ratelimit.NewMemoryStore(),
+		TrustedProxies: cfg.RateLimit.TrustedProxies,
+	})
+	if err != nil {
+		return fmt.Errorf("constructing rate limiter: %w", err)
+	}
+
+	limits := handlers.RateLimits{
+		Standard: ratelimit.Policy{
+			Default: ratelimit.Limit{Requests: cfg.RateLimit.Requests, Window: cfg.RateLimit.Window},
+			Roles: map[string]ratelimit.Limit{
+				user.RoleAdmin.Name(): {Requests: cfg.RateLimit.AdminRequests, Window: cfg.RateLimit.Window},
+			},
+		},
+		Token: ratelimit.Policy{
+			Default: ratelimit.Limit{Requests: cfg.RateLimit.TokenRequests, Window: cfg.RateLimit.Window},
+		},
+	}
+
+	if err := limits.Standard.Validate(); err != nil {
+		return fmt.Errorf("validating standard rate limits: %w", err)
+	}
+	if err := limits.Token.Validate(); err != nil {
+		return fmt.Errorf("validating token rate limits: %w", err)
+	}
+
+	// -------------------------------------------------------------------------
+	// Initialize idempotency support
+
+	log.Infow("startup", "status", "initializing idempotency support", "ttl", cfg.Idempotency.TTL)
+
+	recorder := idempotency.New(idempotency.Config{
+		Log:   log,
+		Store: idempotency.NewMemoryStore(),
+		TTL:   cfg.Idempotency.TTL,
+	})
+
+	// -------------------------------------------------------------------------
+	// Initialize load shedding support
+
+	log.Infow("startup", "status", "initializing load shedding support", "limit", cfg.LoadShed.InitialLimit)
+
+	shedder := loadshed.New(loadshed.Config{
+		InitialLimit: cfg.LoadShed.InitialLimit,
+		MinLimit:     cfg.LoadShed.MinLimit,
+		MaxLimit:     cfg.LoadShed.MaxLimit,
+		Tolerance:    cfg.LoadShed.Tolerance,
+		Smoothing:    cfg.LoadShed.Smoothing,
+	})
+
+	// -------------------------------------------------------------------------
+	// Start Tracing Support
+
+	log.Infow("startup", "status", "initializing OT/Tempo tracing support", "exporter", cfg.Tempo.Exporter)
+
+	traceProvider, err := startTracing(
+		cfg.Tempo.ServiceName,
+		cfg.Tempo.Exporter,
+		cfg.Tempo.Endpoint,
+		cfg.Tempo.Probability,
+	)
+	if err != nil {
+		return fmt.Errorf("starting tracing: %w", err)
+	}
+
+	// The span exporter is a background worker, so the spans it holds are
+	// flushed once the requests are drained.
+	coord.Add("tracing", traceProvider.Shutdown)
+
+	tracer := traceProvider.Tracer("service")
+
+	// -------------------------------------------------------------------------
+	// Initialize TLS support
+
+	// Both servers serve plaintext unless a certificate is configured. The
+	// debug server verifies client certificates on its own terms, since the
+	// kubelet probes it without one.
+	var apiTLS, debugTLS *tls.Config
+	if cfg.TLS.CertFile != "" {
+		log.Infow("startup", "status", "initializing TLS support", "cert", cfg.TLS.CertFile, "clientAuth", cfg.TLS.ClientAuth)
+
+		tlsCfg := tlsconfig.Config{
+			Log:            log,
+			CertFile:       cfg.TLS.CertFile,
+			KeyFile:        cfg.TLS.KeyFile,
+			ClientCAFile:   cfg.TLS.ClientCAFile,
+			ClientAuth:     cfg.TLS.ClientAuth,
+			MinVersion:     cfg.TLS.MinVersion,
+			CipherSuites:   cfg.TLS.CipherSuites,
+			ReloadInterval: cfg.TLS.ReloadInterval,
+		}
+
+		if apiTLS, err = tlsconfig.New(tlsCfg); err != nil {
+			return fmt.Errorf("constructing api tls config: %w", err)
+		}
+
+		tlsCfg.ClientAuth = cfg.TLS.DebugClientAuth
+		if debugTLS, err = tlsconfig.New(tlsCfg); err != nil {
+			return fmt.Errorf("constructing debug tls config: %w", err)
+		}
+	}
+
 	// -------------------------------------------------------------------------
 	// Start Debug Service
 
 	log.Infow("startup", "status", "debug v1 router started", "host", cfg.Web.DebugHost)
 
+	debugServer := http.Server{
+		Addr:      cfg.Web.DebugHost,
+		Handler:   debug.Mux(build, log, db, coord.Draining()),
+		TLSConfig: debugTLS,
+		ErrorLog:  zap.NewStdLog(log.Desugar()),
+	}
+
 	go func() {
-		if err := http.ListenAndServe(cfg.Web.DebugHost, debug.Mux(build, log, db)); err != nil {
+		if err := listenAndServe(&debugServer); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Errorw("shutdown", "status", "debug v1 router closed", "host", cfg.Web.DebugHost, "ERROR", err)
 		}
 	}()
 
+	// The debug server keeps reporting readiness and metrics until the
+	// requests are drained.
+	coord.Add("debug server", func(ctx context.Context) error {
+		if err := debugServer.Shutdown(ctx); err != nil {
+			debugServer.Close()
+			return err
+		}
+		return nil
+	})
+
+	// -------------------------------------------------------------------------
+	// Initialize event support
+
+	log.Infow("startup", "status", "initializing event support", "buffer", cfg.Events.Buffer)
+
+	bus := event.NewBus(cfg.Events.Buffer)
+
 	// -------------------------------------------------------------------------
 	// Start API Service
 
@@ -162,11 +422,44 @@ func run(log *zap.SugaredLogger) error {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
+	cors := mid.CORSConfig{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	}
+
+	if err := cors.Validate(); err != nil {
+		return fmt.Errorf("validating cors: %w", err)
+	}
+
 	apiMux := handlers.APIMux(handlers.APIMuxConfig{
-		Shutdown: shutdown,
-		Log:      log,
-		Auth:     authCong,
-		DB:       db,
+		Shutdown:    shutdown,
+		Log:         log,
+		Auth:        authCong,
+		DB:          db,
+		Hasher:      hasher,
+		Tracer:      tracer,
+		Limiter:     limiter,
+		Limits:      limits,
+		Idempotency: recorder,
+		Shedder:     shedder,
+		Deadlines: handlers.Deadlines{
+			Default: cfg.Deadline.Default,
+			Export:  cfg.Deadline.Export,
+		},
+		CORS: cors,
+		Compress: mid.CompressConfig{
+			MinSize:      cfg.Compress.MinSize,
+			ContentTypes: cfg.Compress.ContentTypes,
+		},
+		Events: handlers.Events{
+			Bus:       bus,
+			Heartbeat: cfg.Events.Heartbeat,
+		},
+		Draining: coord.Draining(),
 	})
 
 	server := http.Server{
@@ -175,16 +468,25 @@ func run(log *zap.SugaredLogger) error {
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
 		IdleTimeout:  cfg.Web.IdleTimeout,
+		TLSConfig:    apiTLS,
 		ErrorLog:     zap.NewStdLog(log.Desugar()),
 	}
 
 	serverErrors := make(chan error, 1)
 
 	go func() {
-		log.Infow("startup", "status", "api router started", "host", server.Addr)
-		serverErrors <- server.ListenAndServe()
+		log.Infow("startup", "status", "api router started", "host", server.Addr, "tls", apiTLS != nil)
+		serverErrors <- listenAndServe(&server)
 	}()
 
+	coord.Add("api requests", func(ctx context.Context) error {
+		if err := server.Shutdown(ctx); err != nil {
+			server.Close()
+			return fmt.Errorf("could not stop server gracefully: %w", err)
+		}
+		return nil
+	})
+
 	// -------------------------------------------------------------------------
 	// Shutdown
 
@@ -196,14 +498,76 @@ func run(log *zap.SugaredLogger) error {
 		log.Infow("shutdown", "status", "shutdown started", "signal", sig)
 		defer log.Infow("shutdown", "status", "shutdown complete", "signal", sig)
 
-		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
-		defer cancel()
-
-		if err := server.Shutdown(ctx); err != nil {
-			server.Close()
-			return fmt.Errorf("could not stop server gracefully: %w", err)
+		if err := coord.Shutdown(); err != nil {
+			return fmt.Errorf("shutdown: %w", err)
 		}
 	}
 
 	return nil
 }
+
+// =============================================================================
+
+// listenAndServe serves TLS when the server has a TLS config, with the
+// certificates it provides, and plaintext otherwise.
+func listenAndServe(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+
+	return server.ListenAndServe()
+}
+
+// startTracing configures open telemetry to be used with the service. The
+// exporter can be "stdout" for local development, "otlp" to send traces to
+// a collector over OTLP/HTTP, or "none" to record spans without exporting.
+func startTracing(serviceName string, exporter string, endpoint string, probability float64) (*sdktrace.TracerProvider, error) {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(probability))),
+		sdktrace.WithResource(
+			resource.NewWithAttributes(
+				semconv.SchemaURL,
+				semconv.ServiceName(serviceName),
+			),
+		),
+	}
+
+	switch exporter {
+	case "none":
+
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("creating stdout exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+
+	case "otlp":
+		exp, err := otlp.New(otlp.Config{Endpoint: endpoint})
+		if err != nil {
+			return nil, fmt.Errorf("creating otlp exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp,
+			sdktrace.WithMaxExportBatchSize(sdktrace.DefaultMaxExportBatchSize),
+			sdktrace.WithBatchTimeout(sdktrace.DefaultScheduleDelay*time.Millisecond),
+		))
+
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", exporter)
+	}
+
+	traceProvider := sdktrace.NewTracerProvider(opts...)
+
+	// We must set this provider as the global provider for things to work,
+	// but we pass this provider around the program where needed to collect
+	// our traces.
+	otel.SetTracerProvider(traceProvider)
+
+	// Continue the traces of callers that send a W3C traceparent header.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return traceProvider, nil
+}
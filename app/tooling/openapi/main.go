@@ -0,0 +1,50 @@
+// This program exports the OpenAPI document of the sales-api.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/shawnzxx/service/app/services/sales-api/handlers"
+)
+
+var out string
+
+func init() {
+	flag.StringVar(&out, "out", "", "file to write the document to, stdout when empty")
+}
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func run() error {
+	doc, err := handlers.OpenAPI().Document()
+	if err != nil {
+		return fmt.Errorf("document: %w", err)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	data = append(data, '\n')
+
+	if out == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package event provides support for publishing the changes the core
+// packages make, so clients can be told about them as they happen. Events
+// are kept in memory, so each instance of the service only knows about the
+// changes it made itself.
+package event
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Set of sources of events.
+const (
+	SourceUser    = "user"
+	SourceProduct = "product"
+)
+
+// Set of types of events.
+const (
+	TypeCreated = "created"
+	TypeUpdated = "updated"
+	TypeDeleted = "deleted"
+)
+
+// subscriberBuffer is the number of events a subscriber can fall behind
+// before it's dropped.
+const subscriberBuffer = 64
+
+// Event describes a change made to an entity. OwnerID is the user the
+// entity belongs to, which decides who is allowed to see the event.
+type Event struct {
+	ID       string
+	Source   string
+	Type     string
+	EntityID string
+	OwnerID  string
+	Time     time.Time
+
+	seq uint64
+}
+
+// Name returns the name of the event, like user.created.
+func (e Event) Name() string {
+	return e.Source + "." + e.Type
+}
+
+// =============================================================================
+
+// Bus delivers published events to the subscribers. The most recent events
+// are kept, so a subscriber that reconnects can resume after the last event
+// it received.
+type Bus struct {
+	epoch    string
+	capacity int
+
+	mu     sync.Mutex
+	seq    uint64
+	recent []Event
+	subs   map[*Subscription]struct{}
+}
+
+// NewBus constructs a bus that keeps the specified number of recent events.
+func NewBus(capacity int) *Bus {
+	return &Bus{
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		capacity: max(capacity, 1),
+		subs:     make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the event its id and delivers it to the subscribers. A
+// subscriber that has fallen too far behind is dropped rather than holding
+// up the publisher. Publishing to a nil bus does nothing, so the core
+// packages can be used without one.
+func (b *Bus) Publish(evt Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	evt.seq = b.seq
+	evt.ID = fmt.Sprintf("%s-%d", b.epoch, b.seq)
+	if evt.Time.IsZero() {
+		evt.Time = time.Now().UTC()
+	}
+
+	if len(b.recent) == b.capacity {
+		b.recent = append(b.recent[:0], b.recent[1:]...)
+	}
+	b.recent = append(b.recent, evt)
+
+	for sub := range b.subs {
+		select {
+		case sub.events <- evt:
+		default:
+			b.drop(sub)
+		}
+	}
+}
+
+// Subscribe starts delivering events to a new subscription. The events
+// published after lastID that are still kept are returned, and complete
+// reports if none were missed. An empty lastID starts from new events.
+func (b *Bus) Subscribe(lastID string) (sub *Subscription, missed []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{
+		events: make(chan Event, subscriberBuffer),
+	}
+	b.subs[sub] = struct{}{}
+
+	if lastID == "" {
+		return sub, nil, true
+	}
+
+	seq, ok := b.sequence(lastID)
+	if !ok {
+		return sub, nil, false
+	}
+
+	// None were missed when the event after lastID is still kept, or there
+	// is no event after it yet.
+	complete = seq == b.seq || b.recent[0].seq <= seq+1
+	for _, evt := range b.recent {
+		if evt.seq > seq {
+			missed = append(missed, evt)
+		}
+	}
+
+	return sub, missed, complete
+}
+
+// Unsubscribe stops delivering events to the subscription.
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.subs[sub]; exists {
+		b.drop(sub)
+	}
+}
+
+// drop removes the subscription and closes its channel.
+func (b *Bus) drop(sub *Subscription) {
+	delete(b.subs, sub)
+	close(sub.events)
+}
+
+// sequence returns the sequence number of an id issued by this bus. Ids
+// from before a restart, or from another instance, aren't recognised.
+func (b *Bus) sequence(id string) (uint64, bool) {
+	epoch, seq, found := strings.Cut(id, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || n > b.seq {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// =============================================================================
+
+// Subscription receives the events published to a bus.
+type Subscription struct {
+	events chan Event
+}
+
+// Events returns the channel events are delivered on. It's closed when the
+// subscriber falls too far behind or unsubscribes.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
@@ -4,15 +4,56 @@ import (
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/shawnzxx/service/business/data/filter"
 	"github.com/shawnzxx/service/business/sys/validate"
 )
 
+// Set of fields the results can be filtered on with operators, like
+// cost[gte]=10. These are the names that should be used by the application
+// layer.
+const (
+	FilterByID          = "product_id"
+	FilterByUserID      = "user_id"
+	FilterByName        = "name"
+	FilterByCost        = "cost"
+	FilterByQuantity    = "quantity"
+	FilterByDateCreated = "date_created"
+)
+
+// FilterFields declares the operators each field can be filtered with.
+var FilterFields = filter.Fields{
+	FilterByID: {
+		Operators: []string{filter.EQ, filter.NE, filter.IN},
+		Parse:     filter.UUID,
+	},
+	FilterByUserID: {
+		Operators: []string{filter.EQ, filter.NE, filter.IN},
+		Parse:     filter.UUID,
+	},
+	FilterByName: {
+		Operators: []string{filter.EQ, filter.NE, filter.IN, filter.LIKE, filter.ILIKE},
+	},
+	FilterByCost: {
+		Operators: []string{filter.EQ, filter.NE, filter.GT, filter.GTE, filter.LT, filter.LTE},
+		Parse:     filter.Number,
+	},
+	FilterByQuantity: {
+		Operators: []string{filter.EQ, filter.NE, filter.GT, filter.GTE, filter.LT, filter.LTE, filter.IN},
+		Parse:     filter.Integer,
+	},
+	FilterByDateCreated: {
+		Operators: []string{filter.GT, filter.GTE, filter.LT, filter.LTE},
+		Parse:     filter.Time,
+	},
+}
+
 // QueryFilter holds the available fields a query can be filtered on.
 type QueryFilter struct {
-	ID       *uuid.UUID `validate:"omitempty"`
-	Name     *string    `validate:"omitempty,min=3"`
-	Cost     *float64   `validate:"omitempty,numeric"`
-	Quantity *int       `validate:"omitempty,numeric"`
+	ID         *uuid.UUID `validate:"omitempty"`
+	Name       *string    `validate:"omitempty,min=3"`
+	Cost       *float64   `validate:"omitempty,numeric"`
+	Quantity   *int       `validate:"omitempty,numeric"`
+	Conditions []filter.Condition
 }
 
 // Validate checks the data in the model is considered clean.
@@ -42,3 +83,8 @@ func (qf *QueryFilter) WithCost(cost float64) {
 func (qf *QueryFilter) WithQuantity(quantity int) {
 	qf.Quantity = &quantity
 }
+
+// WithConditions sets the Conditions field of the QueryFilter value.
+func (qf *QueryFilter) WithConditions(conds []filter.Condition) {
+	qf.Conditions = conds
+}
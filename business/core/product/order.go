@@ -1,6 +1,11 @@
 package product
 
 import (
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/google/uuid"
 	"github.com/shawnzxx/service/business/data/order"
 )
 
@@ -18,3 +23,48 @@ const (
 	OrderByRevenue  = "revenue"
 	OrderByUserID   = "userid"
 )
+
+// SeekAfter returns the seek that starts results ordered by the fields after
+// the product.
+func SeekAfter(prd Product, orderBy []order.By) order.Seek {
+	return order.NewSeek(orderBy, OrderByProdID, func(field string) string {
+		switch field {
+		case OrderByName:
+			return prd.Name
+		case OrderByCost:
+			return strconv.FormatFloat(prd.Cost, 'f', -1, 64)
+		case OrderByQuantity:
+			return strconv.Itoa(prd.Quantity)
+		case OrderByUserID:
+			return prd.UserID.String()
+		default:
+			return prd.ID.String()
+		}
+	})
+}
+
+// CheckSeek checks a seek read from a client, which must hold the values
+// SeekAfter would for the fields.
+func CheckSeek(seek order.Seek, orderBy []order.By) error {
+	return seek.Check(orderBy, OrderByProdID, func(field string, value string) error {
+		switch field {
+		case OrderByProdID, OrderByUserID:
+			_, err := uuid.Parse(value)
+			return err
+		case OrderByCost:
+			cost, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return err
+			}
+			if math.IsInf(cost, 0) || math.IsNaN(cost) {
+				return errors.New("cost must be a finite number")
+			}
+			return nil
+		case OrderByQuantity:
+			_, err := strconv.ParseInt(value, 10, 32)
+			return err
+		default:
+			return nil
+		}
+	})
+}
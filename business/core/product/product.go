@@ -11,7 +11,9 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shawnzxx/service/business/core/event"
 	"github.com/shawnzxx/service/business/core/user"
+	"github.com/shawnzxx/service/foundation/web"
 	"go.uber.org/zap"
 )
 
@@ -26,10 +28,13 @@ type Storer interface {
 	Create(ctx context.Context, prd Product) error
 	Update(ctx context.Context, prd Product) error
 	Delete(ctx context.Context, prd Product) error
-	Query(ctx context.Context, filter QueryFilter, orderBy order.By, pageNumber int, rowsPerPage int) ([]Product, error)
+	Query(ctx context.Context, filter QueryFilter, orderBy []order.By, pageNumber int, rowsPerPage int) ([]Product, error)
+	QuerySeek(ctx context.Context, filter QueryFilter, orderBy []order.By, seek order.Seek, rowsPerPage int) ([]Product, error)
+	Stream(ctx context.Context, filter QueryFilter, orderBy []order.By, fn func(Product) error) error
 	Count(ctx context.Context, filter QueryFilter) (int, error)
 	QueryByID(ctx context.Context, productID uuid.UUID) (Product, error)
 	QueryByUserID(ctx context.Context, userID uuid.UUID) ([]Product, error)
+	QueryByUserIDs(ctx context.Context, userIDs []uuid.UUID) ([]Product, error)
 }
 
 // Core manages the set of APIs for product access.
@@ -37,16 +42,19 @@ type Core struct {
 	log     *zap.SugaredLogger
 	usrCore *user.Core
 	storer  Storer
+	events  *event.Bus
 }
 
 // NewCore constructs a core for product api access.
 // since product embedded user.ID, so we can inject usrCore into product.NewCore
 // we didn't use it, but we just to show philosophy of inject usr domain into product.NewCore
-func NewCore(log *zap.SugaredLogger, usrCore *user.Core, storer Storer) *Core {
+// Changes to products are published to the events bus, which can be nil.
+func NewCore(log *zap.SugaredLogger, usrCore *user.Core, storer Storer, events *event.Bus) *Core {
 	core := Core{
 		log:     log,
 		usrCore: usrCore,
 		storer:  storer,
+		events:  events,
 	}
 
 	return &core
@@ -55,6 +63,9 @@ func NewCore(log *zap.SugaredLogger, usrCore *user.Core, storer Storer) *Core {
 // Create adds a Product to the database. It returns the created Product with
 // fields like ID and DateCreated populated.
 func (c *Core) Create(ctx context.Context, np NewProduct) (Product, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.product.create")
+	defer span.End()
+
 	now := time.Now()
 
 	prd := Product{
@@ -71,12 +82,17 @@ func (c *Core) Create(ctx context.Context, np NewProduct) (Product, error) {
 		return Product{}, fmt.Errorf("create: %w", err)
 	}
 
+	c.publish(event.TypeCreated, prd)
+
 	return prd, nil
 }
 
 // Update modifies data about a Product. It will error if the specified ID is
 // invalid or does not reference an existing Product.
 func (c *Core) Update(ctx context.Context, prd Product, up UpdateProduct) (Product, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.product.update")
+	defer span.End()
+
 	if up.Name != nil {
 		prd.Name = *up.Name
 	}
@@ -92,20 +108,30 @@ func (c *Core) Update(ctx context.Context, prd Product, up UpdateProduct) (Produ
 		return Product{}, fmt.Errorf("update: %w", err)
 	}
 
+	c.publish(event.TypeUpdated, prd)
+
 	return prd, nil
 }
 
 // Delete removes the product identified by a given ID.
 func (c *Core) Delete(ctx context.Context, prd Product) error {
+	ctx, span := web.AddSpan(ctx, "business.core.product.delete")
+	defer span.End()
+
 	if err := c.storer.Delete(ctx, prd); err != nil {
 		return fmt.Errorf("delete: %w", err)
 	}
 
+	c.publish(event.TypeDeleted, prd)
+
 	return nil
 }
 
 // Query gets all Products from the database.
-func (c *Core) Query(ctx context.Context, filter QueryFilter, orderBy order.By, pageNumber int, rowsPerPage int) ([]Product, error) {
+func (c *Core) Query(ctx context.Context, filter QueryFilter, orderBy []order.By, pageNumber int, rowsPerPage int) ([]Product, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.product.query")
+	defer span.End()
+
 	prds, err := c.storer.Query(ctx, filter, orderBy, pageNumber, rowsPerPage)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
@@ -114,13 +140,46 @@ func (c *Core) Query(ctx context.Context, filter QueryFilter, orderBy order.By,
 	return prds, nil
 }
 
+// QuerySeek retrieves a page of products that starts after the seek, or
+// ends before it for a backward seek.
+func (c *Core) QuerySeek(ctx context.Context, filter QueryFilter, orderBy []order.By, seek order.Seek, rowsPerPage int) ([]Product, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.product.queryseek")
+	defer span.End()
+
+	prds, err := c.storer.QuerySeek(ctx, filter, orderBy, seek, rowsPerPage)
+	if err != nil {
+		return nil, fmt.Errorf("queryseek: %w", err)
+	}
+
+	return prds, nil
+}
+
+// Stream passes every product that matches the filter to the function, one
+// at a time, without loading the whole result into memory.
+func (c *Core) Stream(ctx context.Context, filter QueryFilter, orderBy []order.By, fn func(Product) error) error {
+	ctx, span := web.AddSpan(ctx, "business.core.product.stream")
+	defer span.End()
+
+	if err := c.storer.Stream(ctx, filter, orderBy, fn); err != nil {
+		return fmt.Errorf("stream: %w", err)
+	}
+
+	return nil
+}
+
 // Count returns the total number of products in the store.
 func (c *Core) Count(ctx context.Context, filter QueryFilter) (int, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.product.count")
+	defer span.End()
+
 	return c.storer.Count(ctx, filter)
 }
 
 // QueryByID finds the product identified by a given ID.
 func (c *Core) QueryByID(ctx context.Context, productID uuid.UUID) (Product, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.product.querybyid")
+	defer span.End()
+
 	prd, err := c.storer.QueryByID(ctx, productID)
 	if err != nil {
 		return Product{}, fmt.Errorf("query: productID[%s]: %w", productID, err)
@@ -131,6 +190,9 @@ func (c *Core) QueryByID(ctx context.Context, productID uuid.UUID) (Product, err
 
 // QueryByUserID finds the products identified by a given User ID.
 func (c *Core) QueryByUserID(ctx context.Context, userID uuid.UUID) ([]Product, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.product.querybyuserid")
+	defer span.End()
+
 	prds, err := c.storer.QueryByUserID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
@@ -138,3 +200,32 @@ func (c *Core) QueryByUserID(ctx context.Context, userID uuid.UUID) ([]Product,
 
 	return prds, nil
 }
+
+// QueryByUserIDs finds the products of the given users in one call, so
+// loading the products of a page of users doesn't take a call per user.
+func (c *Core) QueryByUserIDs(ctx context.Context, userIDs []uuid.UUID) ([]Product, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.product.querybyuserids")
+	defer span.End()
+
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	prds, err := c.storer.QueryByUserIDs(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return prds, nil
+}
+
+// publish tells the subscribers of the events bus about a change to the
+// product. A product is owned by the user it belongs to.
+func (c *Core) publish(typ string, prd Product) {
+	c.events.Publish(event.Event{
+		Source:   event.SourceProduct,
+		Type:     typ,
+		EntityID: prd.ID.String(),
+		OwnerID:  prd.UserID.String(),
+	})
+}
@@ -0,0 +1,59 @@
+package productdb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/data/filter"
+)
+
+// filterColumns maps the fields results can be filtered on to the columns
+// they're compared with.
+var filterColumns = filter.Columns{
+	product.FilterByID:          {Name: "product_id", Type: "uuid"},
+	product.FilterByUserID:      {Name: "user_id", Type: "uuid"},
+	product.FilterByName:        {Name: "name", Type: "text"},
+	product.FilterByCost:        {Name: "cost", Type: "numeric"},
+	product.FilterByQuantity:    {Name: "quantity", Type: "int"},
+	product.FilterByDateCreated: {Name: "date_created", Type: "timestamp"},
+}
+
+// applyFilter writes the WHERE clause for the filter, together with the
+// conditions in wc. The values of the conditions are passed as named
+// parameters.
+func (s *Store) applyFilter(filter product.QueryFilter, data map[string]interface{}, buf *bytes.Buffer, wc ...string) error {
+	if filter.ID != nil {
+		data["product_id"] = *filter.ID
+		wc = append(wc, "product_id = :product_id")
+	}
+
+	if filter.Name != nil {
+		data["name"] = fmt.Sprintf("%%%s%%", *filter.Name)
+		wc = append(wc, "name LIKE :name")
+	}
+
+	if filter.Cost != nil {
+		data["cost"] = *filter.Cost
+		wc = append(wc, "cost = :cost")
+	}
+
+	if filter.Quantity != nil {
+		data["quantity"] = *filter.Quantity
+		wc = append(wc, "quantity = :quantity")
+	}
+
+	conds, err := filterColumns.Where(filter.Conditions, data)
+	if err != nil {
+		return err
+	}
+	wc = append(wc, conds...)
+
+	if len(wc) > 0 {
+		buf.WriteString(" WHERE ")
+		buf.WriteString(strings.Join(wc, " AND "))
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package productdb
+
+import (
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/data/order"
+)
+
+// keyset describes the columns products are ordered by.
+var keyset = order.Keyset{
+	Key: product.OrderByProdID,
+	Columns: map[string]order.Column{
+		product.OrderByProdID:   {Name: "product_id", Type: "uuid"},
+		product.OrderByName:     {Name: "name", Type: "text"},
+		product.OrderByCost:     {Name: "cost", Type: "numeric"},
+		product.OrderByQuantity: {Name: "quantity", Type: "int"},
+		product.OrderByUserID:   {Name: "user_id", Type: "uuid"},
+	},
+}
+
+// orderByClause returns the ORDER BY clause for the fields. Rows that are
+// equal on all the fields are ordered by the primary key, so the order is
+// the same every time the query runs.
+func orderByClause(orderBy []order.By) (string, error) {
+	return keyset.OrderBy(orderBy, order.Seek{})
+}
@@ -0,0 +1,314 @@
+// Package productdb contains product related CRUD functionality.
+package productdb
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/data/order"
+	database "github.com/shawnzxx/service/business/sys/database/pgx"
+	"github.com/shawnzxx/service/business/sys/database/pgx/dbarray"
+	"go.uber.org/zap"
+)
+
+// Store manages the set of APIs for product database access.
+type Store struct {
+	log *zap.SugaredLogger
+	db  *sqlx.DB
+}
+
+// NewStore constructs the api for data access.
+func NewStore(log *zap.SugaredLogger, db *sqlx.DB) *Store {
+	return &Store{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create adds a Product to the database.
+func (s *Store) Create(ctx context.Context, prd product.Product) error {
+	const q = `
+	INSERT INTO products
+		(product_id, user_id, name, cost, quantity, date_created, date_updated)
+	VALUES
+		(:product_id, :user_id, :name, :cost, :quantity, :date_created, :date_updated)`
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, q, toDBProduct(prd)); err != nil {
+		return fmt.Errorf("namedexeccontext: %w", err)
+	}
+
+	return nil
+}
+
+// Update modifies data about a Product.
+func (s *Store) Update(ctx context.Context, prd product.Product) error {
+	const q = `
+	UPDATE
+		products
+	SET
+		"name" = :name,
+		"cost" = :cost,
+		"quantity" = :quantity,
+		"date_updated" = :date_updated
+	WHERE
+		product_id = :product_id`
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, q, toDBProduct(prd)); err != nil {
+		return fmt.Errorf("namedexeccontext: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the product identified by a given ID.
+func (s *Store) Delete(ctx context.Context, prd product.Product) error {
+	data := struct {
+		ID string `db:"product_id"`
+	}{
+		ID: prd.ID.String(),
+	}
+
+	const q = `
+	DELETE FROM
+		products
+	WHERE
+		product_id = :product_id`
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, q, data); err != nil {
+		return fmt.Errorf("namedexeccontext: %w", err)
+	}
+
+	return nil
+}
+
+// Query gets all Products from the database.
+func (s *Store) Query(ctx context.Context, filter product.QueryFilter, orderBy []order.By, pageNumber int, rowsPerPage int) ([]product.Product, error) {
+	data := map[string]interface{}{
+		"offset":        (pageNumber - 1) * rowsPerPage,
+		"rows_per_page": rowsPerPage,
+	}
+
+	const q = `
+	SELECT
+		product_id, user_id, name, cost, quantity, date_created, date_updated
+	FROM
+		products`
+
+	buf := bytes.NewBufferString(q)
+	if err := s.applyFilter(filter, data, buf); err != nil {
+		return nil, err
+	}
+
+	orderByClause, err := orderByClause(orderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteString(orderByClause)
+	buf.WriteString(" OFFSET :offset ROWS FETCH NEXT :rows_per_page ROWS ONLY")
+
+	var dbPrds []dbProduct
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, buf.String(), data, &dbPrds); err != nil {
+		return nil, fmt.Errorf("namedqueryslice: %w", err)
+	}
+
+	return toCoreProductSlice(dbPrds), nil
+}
+
+// QuerySeek retrieves the products after the seek, or before it for a
+// backward seek, from the database. Unlike Query, it doesn't skip the rows
+// of the pages before, so it's as fast for the last page as the first.
+func (s *Store) QuerySeek(ctx context.Context, filter product.QueryFilter, orderBy []order.By, seek order.Seek, rowsPerPage int) ([]product.Product, error) {
+	data := map[string]interface{}{
+		"rows_per_page": rowsPerPage,
+	}
+
+	const q = `
+	SELECT
+		product_id, user_id, name, cost, quantity, date_created, date_updated
+	FROM
+		products`
+
+	seekClause, err := keyset.Where(orderBy, seek, data)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBufferString(q)
+	if err := s.applyFilter(filter, data, buf, seekClause); err != nil {
+		return nil, err
+	}
+
+	orderByClause, err := keyset.OrderBy(orderBy, seek)
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteString(orderByClause)
+	buf.WriteString(" FETCH FIRST :rows_per_page ROWS ONLY")
+
+	var dbPrds []dbProduct
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, buf.String(), data, &dbPrds); err != nil {
+		return nil, fmt.Errorf("namedqueryslice: %w", err)
+	}
+
+	// A backward seek reads the rows in reverse, so they're put back in
+	// the order asked for.
+	if seek.Backward {
+		slices.Reverse(dbPrds)
+	}
+
+	return toCoreProductSlice(dbPrds), nil
+}
+
+// Stream retrieves all the products that match the filter from the
+// database, passing each one to the function as it's read.
+func (s *Store) Stream(ctx context.Context, filter product.QueryFilter, orderBy []order.By, fn func(product.Product) error) error {
+	data := map[string]interface{}{}
+
+	const q = `
+	SELECT
+		product_id, user_id, name, cost, quantity, date_created, date_updated
+	FROM
+		products`
+
+	buf := bytes.NewBufferString(q)
+	if err := s.applyFilter(filter, data, buf); err != nil {
+		return err
+	}
+
+	orderByClause, err := orderByClause(orderBy)
+	if err != nil {
+		return err
+	}
+
+	buf.WriteString(orderByClause)
+
+	f := func(dbPrd dbProduct) error {
+		return fn(toCoreProduct(dbPrd))
+	}
+
+	if err := database.NamedQueryStream(ctx, s.log, s.db, buf.String(), data, f); err != nil {
+		return fmt.Errorf("namedquerystream: %w", err)
+	}
+
+	return nil
+}
+
+// Count returns the total number of products in the DB.
+func (s *Store) Count(ctx context.Context, filter product.QueryFilter) (int, error) {
+	data := map[string]interface{}{}
+
+	const q = `
+	SELECT
+		count(1)
+	FROM
+		products`
+
+	buf := bytes.NewBufferString(q)
+	if err := s.applyFilter(filter, data, buf); err != nil {
+		return 0, err
+	}
+
+	var count struct {
+		Count int `db:"count"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, buf.String(), data, &count); err != nil {
+		return 0, fmt.Errorf("namedquerystruct: %w", err)
+	}
+
+	return count.Count, nil
+}
+
+// QueryByID finds the product identified by a given ID.
+func (s *Store) QueryByID(ctx context.Context, productID uuid.UUID) (product.Product, error) {
+	data := struct {
+		ID string `db:"product_id"`
+	}{
+		ID: productID.String(),
+	}
+
+	const q = `
+	SELECT
+		product_id, user_id, name, cost, quantity, date_created, date_updated
+	FROM
+		products
+	WHERE
+		product_id = :product_id`
+
+	var dbPrd dbProduct
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &dbPrd); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return product.Product{}, fmt.Errorf("namedquerystruct: %w", product.ErrNotFound)
+		}
+		return product.Product{}, fmt.Errorf("namedquerystruct: %w", err)
+	}
+
+	return toCoreProduct(dbPrd), nil
+}
+
+// QueryByUserID finds the products identified by a given User ID.
+func (s *Store) QueryByUserID(ctx context.Context, userID uuid.UUID) ([]product.Product, error) {
+	data := struct {
+		ID string `db:"user_id"`
+	}{
+		ID: userID.String(),
+	}
+
+	const q = `
+	SELECT
+		product_id, user_id, name, cost, quantity, date_created, date_updated
+	FROM
+		products
+	WHERE
+		user_id = :user_id`
+
+	var dbPrds []dbProduct
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &dbPrds); err != nil {
+		return nil, fmt.Errorf("namedqueryslice: %w", err)
+	}
+
+	return toCoreProductSlice(dbPrds), nil
+}
+
+// QueryByUserIDs finds the products of the given users in a single query.
+func (s *Store) QueryByUserIDs(ctx context.Context, userIDs []uuid.UUID) ([]product.Product, error) {
+	ids := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		ids[i] = userID.String()
+	}
+
+	data := struct {
+		UserID interface {
+			driver.Valuer
+			sql.Scanner
+		} `db:"user_id"`
+	}{
+		UserID: dbarray.Array(ids),
+	}
+
+	const q = `
+	SELECT
+		product_id, user_id, name, cost, quantity, date_created, date_updated
+	FROM
+		products
+	WHERE
+		user_id = ANY(:user_id)
+	ORDER BY
+		user_id, product_id`
+
+	var dbPrds []dbProduct
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, q, data, &dbPrds); err != nil {
+		return nil, fmt.Errorf("namedqueryslice: %w", err)
+	}
+
+	return toCoreProductSlice(dbPrds), nil
+}
@@ -0,0 +1,62 @@
+package user
+
+import (
+	"github.com/shawnzxx/service/business/data/order"
+)
+
+// Set of fields of a user that can be selected, so only those are read from
+// the store. These are the names that should be used by the application
+// layer.
+const (
+	FieldID          = "id"
+	FieldName        = "name"
+	FieldEmail       = "email"
+	FieldRoles       = "roles"
+	FieldDepartment  = "department"
+	FieldEnabled     = "enabled"
+	FieldMFAEnabled  = "mfaEnabled"
+	FieldDateCreated = "dateCreated"
+	FieldDateUpdated = "dateUpdated"
+)
+
+// orderFields maps the fields results can be ordered by to the fields they
+// are read from.
+var orderFields = map[string]string{
+	OrderByID:         FieldID,
+	OrderByName:       FieldName,
+	OrderByEmail:      FieldEmail,
+	OrderByRoles:      FieldRoles,
+	OrderByEnabled:    FieldEnabled,
+	OrderByDepartment: FieldDepartment,
+}
+
+// selectFields returns the fields to read. Besides the fields asked for,
+// the id and the fields the results are ordered by are read, since they're
+// needed to page through the results. No fields means all of them.
+func selectFields(fields []string, orderBy []order.By) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	selected := make([]string, 0, len(fields)+len(orderBy)+1)
+	seen := make(map[string]struct{})
+
+	add := func(field string) {
+		if _, exists := seen[field]; !exists {
+			seen[field] = struct{}{}
+			selected = append(selected, field)
+		}
+	}
+
+	add(FieldID)
+	for _, by := range orderBy {
+		if field, exists := orderFields[by.Field]; exists {
+			add(field)
+		}
+	}
+	for _, field := range fields {
+		add(field)
+	}
+
+	return selected
+}
@@ -6,9 +6,60 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shawnzxx/service/business/data/filter"
 	"github.com/shawnzxx/service/business/sys/validate"
 )
 
+// Set of fields the results can be filtered on with operators, like
+// roles[in]=ADMIN,USER. These are the names that should be used by the
+// application layer.
+const (
+	FilterByID          = "user_id"
+	FilterByName        = "name"
+	FilterByEmail       = "email"
+	FilterByRoles       = "roles"
+	FilterByDepartment  = "department"
+	FilterByEnabled     = "enabled"
+	FilterByDateCreated = "date_created"
+)
+
+// FilterFields declares the operators each field can be filtered with.
+var FilterFields = filter.Fields{
+	FilterByID: {
+		Operators: []string{filter.EQ, filter.NE, filter.IN},
+		Parse:     filter.UUID,
+	},
+	FilterByName: {
+		Operators: []string{filter.EQ, filter.NE, filter.IN, filter.LIKE, filter.ILIKE},
+	},
+	FilterByEmail: {
+		Operators: []string{filter.EQ, filter.NE, filter.IN, filter.LIKE, filter.ILIKE},
+	},
+	FilterByRoles: {
+		Operators: []string{filter.EQ, filter.NE, filter.IN},
+		Parse:     parseRoleName,
+	},
+	FilterByDepartment: {
+		Operators: []string{filter.EQ, filter.NE, filter.IN, filter.LIKE, filter.ILIKE},
+	},
+	FilterByEnabled: {
+		Operators: []string{filter.EQ, filter.NE},
+		Parse:     filter.Bool,
+	},
+	FilterByDateCreated: {
+		Operators: []string{filter.GT, filter.GTE, filter.LT, filter.LTE},
+		Parse:     filter.Time,
+	},
+}
+
+func parseRoleName(value string) (string, error) {
+	role, err := ParseRole(value)
+	if err != nil {
+		return "", err
+	}
+	return role.Name(), nil
+}
+
 // QueryFilter holds the available fields a query can be filtered on.
 type QueryFilter struct {
 	ID               *uuid.UUID    `validate:"omitempty"`
@@ -16,6 +67,7 @@ type QueryFilter struct {
 	Email            *mail.Address `validate:"omitempty"`
 	StartCreatedDate *time.Time    `validate:"omitempty"`
 	EndCreatedDate   *time.Time    `validate:"omitempty"`
+	Conditions       []filter.Condition
 }
 
 // Validate checks the data in the model is considered clean.
@@ -52,3 +104,8 @@ func (qf *QueryFilter) WithEndCreatedDate(endDate time.Time) {
 	d := endDate.UTC()
 	qf.EndCreatedDate = &d
 }
+
+// WithConditions sets the Conditions field of the QueryFilter value.
+func (qf *QueryFilter) WithConditions(conds []filter.Condition) {
+	qf.Conditions = conds
+}
@@ -0,0 +1,194 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shawnzxx/service/business/core/event"
+	"github.com/shawnzxx/service/foundation/totp"
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// Set of error variables for multi-factor authentication.
+var (
+	ErrMFAEnabled     = errors.New("multi-factor authentication is already enabled")
+	ErrMFANotEnrolled = errors.New("multi-factor authentication is not enrolled")
+	ErrMFAInvalidCode = errors.New("multi-factor authentication code is not valid")
+)
+
+// recoveryCodeCount is the number of recovery codes issued on enrolment.
+const recoveryCodeCount = 10
+
+// EnrollMFA generates a new TOTP secret for the user. MFA is not enforced
+// until the user confirms a code generated from the secret.
+func (c *Core) EnrollMFA(ctx context.Context, usr User, issuer string) (MFAEnrollment, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.enrollmfa")
+	defer span.End()
+
+	if usr.MFA.Enabled {
+		return MFAEnrollment{}, ErrMFAEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return MFAEnrollment{}, fmt.Errorf("generatesecret: %w", err)
+	}
+
+	usr.MFA = MFA{
+		Secret: secret,
+	}
+	usr.DateUpdated = time.Now()
+
+	if err := c.storer.Update(ctx, usr); err != nil {
+		return MFAEnrollment{}, fmt.Errorf("update: %w", err)
+	}
+
+	enr := MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(issuer, usr.Email.Address, secret),
+	}
+
+	return enr, nil
+}
+
+// ConfirmMFA enables MFA for the user once the code matches the pending
+// secret. It returns the recovery codes, which are only shown this one time.
+func (c *Core) ConfirmMFA(ctx context.Context, usr User, code string) ([]string, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.confirmmfa")
+	defer span.End()
+
+	if usr.MFA.Enabled {
+		return nil, ErrMFAEnabled
+	}
+
+	if usr.MFA.Secret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	step, valid, err := totp.Validate(usr.MFA.Secret, code, time.Now(), usr.MFA.LastStep)
+	if err != nil {
+		return nil, fmt.Errorf("validate: %w", err)
+	}
+	if !valid {
+		return nil, ErrMFAInvalidCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("generaterecoverycode: %w", err)
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	usr.MFA.Enabled = true
+	usr.MFA.RecoveryCodes = hashes
+	usr.MFA.LastStep = step
+	usr.DateUpdated = time.Now()
+
+	if err := c.storer.Update(ctx, usr); err != nil {
+		return nil, fmt.Errorf("update: %w", err)
+	}
+
+	c.publish(event.TypeUpdated, usr)
+
+	return codes, nil
+}
+
+// VerifyMFA checks the code against the user's TOTP secret, falling back to
+// the recovery codes. Codes can only be used once: the step of the last TOTP
+// code accepted is kept, and a recovery code is removed once used. Both are
+// written with the version the user was read with, so of two requests using
+// the same code only one succeeds. It reports if a recovery code was used.
+func (c *Core) VerifyMFA(ctx context.Context, usr User, code string) (recovery bool, err error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.verifymfa")
+	defer span.End()
+
+	if !usr.MFA.Enabled {
+		return false, ErrMFANotEnrolled
+	}
+
+	step, valid, err := totp.Validate(usr.MFA.Secret, code, time.Now(), usr.MFA.LastStep)
+	if err != nil {
+		return false, fmt.Errorf("validate: %w", err)
+	}
+	if valid {
+		usr.MFA.LastStep = step
+		usr.DateUpdated = time.Now()
+
+		if err := c.useCode(ctx, usr); err != nil {
+			return false, err
+		}
+
+		return false, nil
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, stored := range usr.MFA.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(stored)) != 1 {
+			continue
+		}
+
+		codes := make([]string, 0, len(usr.MFA.RecoveryCodes)-1)
+		codes = append(codes, usr.MFA.RecoveryCodes[:i]...)
+		codes = append(codes, usr.MFA.RecoveryCodes[i+1:]...)
+
+		usr.MFA.RecoveryCodes = codes
+		usr.DateUpdated = time.Now()
+
+		if err := c.useCode(ctx, usr); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	return false, ErrMFAInvalidCode
+}
+
+// useCode records that a code was used. When the user was changed since it
+// was read the code may just have been used by another request, so it's
+// treated as not valid.
+func (c *Core) useCode(ctx context.Context, usr User) error {
+	if err := c.storer.Update(ctx, usr); err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			return ErrMFAInvalidCode
+		}
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// generateRecoveryCode returns a random code in the form XXXXX-XXXXX.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)[:10]
+
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode returns the hex encoded SHA-256 hash of the code. Recovery
+// codes are random and long enough that a slow password hash is not needed.
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -19,10 +19,30 @@ type User struct {
 	PasswordHash []byte
 	Department   string
 	Enabled      bool
+	MFA          MFA
+	Version      int
 	DateCreated  time.Time
 	DateUpdated  time.Time
 }
 
+// MFA represents the multi-factor authentication settings of a user. The
+// secret is stored while enrolment is pending and MFA is only enforced once
+// the user confirms a code. Recovery codes are only stored hashed. LastStep
+// is the time step of the last code accepted, so a code can't be replayed.
+type MFA struct {
+	Secret        string
+	Enabled       bool
+	RecoveryCodes []string
+	LastStep      int64
+}
+
+// MFAEnrollment contains what a client needs to add the account to an
+// authenticator app.
+type MFAEnrollment struct {
+	Secret string
+	URI    string
+}
+
 // NewUser contains information needed to create a new user.
 type NewUser struct {
 	Name            string
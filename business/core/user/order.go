@@ -1,6 +1,11 @@
 package user
 
 import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
 	"github.com/shawnzxx/service/business/data/order"
 )
 
@@ -10,9 +15,66 @@ var DefaultOrderBy = order.NewBy(OrderByID, order.ASC)
 // Set of fields that the results can be ordered by. These are the names
 // that should be used by the application layer.
 const (
-	OrderByID      = "userid"
-	OrderByName    = "name"
-	OrderByEmail   = "email"
-	OrderByRoles   = "roles"
-	OrderByEnabled = "enabled"
+	OrderByID         = "userid"
+	OrderByName       = "name"
+	OrderByEmail      = "email"
+	OrderByRoles      = "roles"
+	OrderByEnabled    = "enabled"
+	OrderByDepartment = "department"
 )
+
+// SeekAfter returns the seek that starts results ordered by the fields after
+// the user. Roles are given in the text form of a list, like {ADMIN,USER}.
+func SeekAfter(usr User, orderBy []order.By) order.Seek {
+	return order.NewSeek(orderBy, OrderByID, func(field string) string {
+		switch field {
+		case OrderByName:
+			return usr.Name
+		case OrderByEmail:
+			return usr.Email.Address
+		case OrderByRoles:
+			roles := make([]string, len(usr.Roles))
+			for i, role := range usr.Roles {
+				roles[i] = role.Name()
+			}
+			return "{" + strings.Join(roles, ",") + "}"
+		case OrderByEnabled:
+			return strconv.FormatBool(usr.Enabled)
+		case OrderByDepartment:
+			return usr.Department
+		default:
+			return usr.ID.String()
+		}
+	})
+}
+
+// CheckSeek checks a seek read from a client, which must hold the values
+// SeekAfter would for the fields.
+func CheckSeek(seek order.Seek, orderBy []order.By) error {
+	return seek.Check(orderBy, OrderByID, func(field string, value string) error {
+		switch field {
+		case OrderByID:
+			_, err := uuid.Parse(value)
+			return err
+		case OrderByRoles:
+			if !strings.HasPrefix(value, "{") || !strings.HasSuffix(value, "}") {
+				return errors.New("roles must be a list, like {ADMIN,USER}")
+			}
+			list := strings.TrimSuffix(strings.TrimPrefix(value, "{"), "}")
+			if list == "" {
+				return nil
+			}
+			for _, role := range strings.Split(list, ",") {
+				if _, err := ParseRole(role); err != nil {
+					return err
+				}
+			}
+			return nil
+		case OrderByEnabled:
+			_, err := strconv.ParseBool(value)
+			return err
+		default:
+			return nil
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package userdb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shawnzxx/service/business/core/user"
+)
+
+var fieldColumns = map[string]string{
+	user.FieldID:          "user_id",
+	user.FieldName:        "name",
+	user.FieldEmail:       "email",
+	user.FieldRoles:       "roles",
+	user.FieldDepartment:  "department",
+	user.FieldEnabled:     "enabled",
+	user.FieldMFAEnabled:  "mfa_enabled",
+	user.FieldDateCreated: "date_created",
+	user.FieldDateUpdated: "date_updated",
+}
+
+// selectColumns returns the list of columns to read for the fields, which
+// is all of them when there are no fields.
+func selectColumns(fields []string) (string, error) {
+	if len(fields) == 0 {
+		return "*", nil
+	}
+
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		column, exists := fieldColumns[field]
+		if !exists {
+			return "", fmt.Errorf("field %q does not exist", field)
+		}
+		columns[i] = column
+	}
+
+	return strings.Join(columns, ", "), nil
+}
@@ -6,11 +6,25 @@ import (
 	"strings"
 
 	"github.com/shawnzxx/service/business/core/user"
+	"github.com/shawnzxx/service/business/data/filter"
 )
 
-func (s *Store) applyFilter(filter user.QueryFilter, data map[string]interface{}, buf *bytes.Buffer) {
-	var wc []string
+// filterColumns maps the fields results can be filtered on to the columns
+// they're compared with.
+var filterColumns = filter.Columns{
+	user.FilterByID:          {Name: "user_id", Type: "uuid"},
+	user.FilterByName:        {Name: "name", Type: "text"},
+	user.FilterByEmail:       {Name: "email", Type: "text"},
+	user.FilterByRoles:       {Name: "roles", Type: "text", Array: true},
+	user.FilterByDepartment:  {Name: "department", Type: "text"},
+	user.FilterByEnabled:     {Name: "enabled", Type: "boolean"},
+	user.FilterByDateCreated: {Name: "date_created", Type: "timestamp"},
+}
 
+// applyFilter writes the WHERE clause for the filter, together with the
+// conditions in wc. The values of the conditions are passed as named
+// parameters.
+func (s *Store) applyFilter(filter user.QueryFilter, data map[string]interface{}, buf *bytes.Buffer, wc ...string) error {
 	if filter.ID != nil {
 		data["user_id"] = *filter.ID
 		wc = append(wc, "user_id = :user_id")
@@ -36,8 +50,16 @@ func (s *Store) applyFilter(filter user.QueryFilter, data map[string]interface{}
 		wc = append(wc, "date_created <= :end_date_created")
 	}
 
+	conds, err := filterColumns.Where(filter.Conditions, data)
+	if err != nil {
+		return err
+	}
+	wc = append(wc, conds...)
+
 	if len(wc) > 0 {
 		buf.WriteString(" WHERE ")
 		buf.WriteString(strings.Join(wc, " AND "))
 	}
+
+	return nil
 }
@@ -23,6 +23,11 @@ type dbUser struct {
 	PasswordHash []byte         `db:"password_hash"`
 	Enabled      bool           `db:"enabled"`
 	Department   sql.NullString `db:"department"`
+	MFASecret    sql.NullString `db:"mfa_secret"`
+	MFAEnabled   bool           `db:"mfa_enabled"`
+	MFACodes     dbarray.String `db:"mfa_recovery_codes"`
+	MFALastStep  int64          `db:"mfa_last_step"`
+	Version      int            `db:"version"`
 	DateCreated  time.Time      `db:"date_created"`
 	DateUpdated  time.Time      `db:"date_updated"`
 }
@@ -44,7 +49,15 @@ func toDBUser(usr user.User) dbUser {
 			String: usr.Department,
 			Valid:  usr.Department != "",
 		},
-		Enabled:     usr.Enabled,
+		Enabled: usr.Enabled,
+		MFASecret: sql.NullString{
+			String: usr.MFA.Secret,
+			Valid:  usr.MFA.Secret != "",
+		},
+		MFAEnabled:  usr.MFA.Enabled,
+		MFACodes:    usr.MFA.RecoveryCodes,
+		MFALastStep: usr.MFA.LastStep,
+		Version:     usr.Version,
 		DateCreated: usr.DateCreated.UTC(),
 		DateUpdated: usr.DateUpdated.UTC(),
 	}
@@ -69,8 +82,15 @@ func toCoreUser(dbUsr dbUser) user.User {
 		PasswordHash: dbUsr.PasswordHash,
 		Enabled:      dbUsr.Enabled,
 		Department:   dbUsr.Department.String,
-		DateCreated:  dbUsr.DateCreated.In(time.Local),
-		DateUpdated:  dbUsr.DateUpdated.In(time.Local),
+		MFA: user.MFA{
+			Secret:        dbUsr.MFASecret.String,
+			Enabled:       dbUsr.MFAEnabled,
+			RecoveryCodes: dbUsr.MFACodes,
+			LastStep:      dbUsr.MFALastStep,
+		},
+		Version:     dbUsr.Version,
+		DateCreated: dbUsr.DateCreated.In(time.Local),
+		DateUpdated: dbUsr.DateUpdated.In(time.Local),
 	}
 
 	return usr
@@ -1,25 +1,28 @@
 package userdb
 
 import (
-	"fmt"
-
 	"github.com/shawnzxx/service/business/core/user"
 	"github.com/shawnzxx/service/business/data/order"
 )
 
-var orderByFields = map[string]string{
-	user.OrderByID:      "user_id",
-	user.OrderByName:    "name",
-	user.OrderByEmail:   "email",
-	user.OrderByRoles:   "roles",
-	user.OrderByEnabled: "enabled",
+// keyset describes the columns users are ordered by. The department can be
+// NULL, which a seek can't compare with, so missing departments are ordered
+// as empty ones.
+var keyset = order.Keyset{
+	Key: user.OrderByID,
+	Columns: map[string]order.Column{
+		user.OrderByID:         {Name: "user_id", Type: "uuid"},
+		user.OrderByName:       {Name: "name", Type: "text"},
+		user.OrderByEmail:      {Name: "email", Type: "text"},
+		user.OrderByRoles:      {Name: "roles", Type: "text[]"},
+		user.OrderByEnabled:    {Name: "enabled", Type: "boolean"},
+		user.OrderByDepartment: {Name: "COALESCE(department, '')", Type: "text"},
+	},
 }
 
-func orderByClause(orderBy order.By) (string, error) {
-	by, exists := orderByFields[orderBy.Field]
-	if !exists {
-		return "", fmt.Errorf("field %q does not exist", orderBy.Field)
-	}
-
-	return " ORDER BY " + by + " " + orderBy.Direction, nil
+// orderByClause returns the ORDER BY clause for the fields. Rows that are
+// equal on all the fields are ordered by the primary key, so the order is
+// the same every time the query runs.
+func orderByClause(orderBy []order.By) (string, error) {
+	return keyset.OrderBy(orderBy, order.Seek{})
 }
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"net/mail"
+	"slices"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -37,9 +38,9 @@ func NewStore(log *zap.SugaredLogger, db *sqlx.DB) *Store {
 func (s *Store) Create(ctx context.Context, usr user.User) error {
 	const q = `
 	INSERT INTO users
-		(user_id, name, email, password_hash, roles, enabled, department, date_created, date_updated)
+		(user_id, name, email, password_hash, roles, enabled, department, mfa_secret, mfa_enabled, mfa_recovery_codes, mfa_last_step, version, date_created, date_updated)
 	VALUES
-		(:user_id, :name, :email, :password_hash, :roles, :enabled, :department, :date_created, :date_updated)`
+		(:user_id, :name, :email, :password_hash, :roles, :enabled, :department, :mfa_secret, :mfa_enabled, :mfa_recovery_codes, :mfa_last_step, :version, :date_created, :date_updated)`
 
 	if err := database.NamedExecContext(ctx, s.log, s.db, q, toDBUser(usr)); err != nil {
 		if errors.Is(err, database.ErrDBDuplicatedEntry) {
@@ -51,7 +52,9 @@ func (s *Store) Create(ctx context.Context, usr user.User) error {
 	return nil
 }
 
-// Update replaces a user document in the database.
+// Update replaces a user document in the database. The update only happens
+// if the row still has the version the user was read with, otherwise
+// user.ErrVersionConflict is returned. The version is incremented.
 func (s *Store) Update(ctx context.Context, usr user.User) error {
 	const q = `
 	UPDATE
@@ -62,56 +65,88 @@ func (s *Store) Update(ctx context.Context, usr user.User) error {
 		"roles" = :roles,
 		"password_hash" = :password_hash,
 		"department" = :department,
+		"mfa_secret" = :mfa_secret,
+		"mfa_enabled" = :mfa_enabled,
+		"mfa_recovery_codes" = :mfa_recovery_codes,
+		"mfa_last_step" = :mfa_last_step,
+		"version" = version + 1,
 		"date_updated" = :date_updated
 	WHERE
-		user_id = :user_id`
+		user_id = :user_id AND version = :version
+	RETURNING
+		version`
 
-	if err := database.NamedExecContext(ctx, s.log, s.db, q, toDBUser(usr)); err != nil {
-		if errors.Is(err, database.ErrDBDuplicatedEntry) {
+	var result struct {
+		Version int `db:"version"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, toDBUser(usr), &result); err != nil {
+		switch {
+		case errors.Is(err, database.ErrDBNotFound):
+			return fmt.Errorf("namedquerystruct: %w", user.ErrVersionConflict)
+		case errors.Is(err, database.ErrDBDuplicatedEntry):
 			return user.ErrUniqueEmail
 		}
-		return fmt.Errorf("namedexeccontext: %w", err)
+		return fmt.Errorf("namedquerystruct: %w", err)
 	}
 
 	return nil
 }
 
-// Delete removes a user from the database.
+// Delete removes a user from the database. The delete only happens if the
+// row still has the version the user was read with, otherwise
+// user.ErrVersionConflict is returned.
 func (s *Store) Delete(ctx context.Context, usr user.User) error {
 	data := struct {
-		UserID string `db:"user_id"`
+		UserID  string `db:"user_id"`
+		Version int    `db:"version"`
 	}{
-		UserID: usr.ID.String(),
+		UserID:  usr.ID.String(),
+		Version: usr.Version,
 	}
 
 	const q = `
 	DELETE FROM
 		users
 	WHERE
-		user_id = :user_id`
+		user_id = :user_id AND version = :version
+	RETURNING
+		user_id`
 
-	if err := database.NamedExecContext(ctx, s.log, s.db, q, data); err != nil {
-		return fmt.Errorf("namedexeccontext: %w", err)
+	var result struct {
+		UserID string `db:"user_id"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, q, data, &result); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return fmt.Errorf("namedquerystruct: %w", user.ErrVersionConflict)
+		}
+		return fmt.Errorf("namedquerystruct: %w", err)
 	}
 
 	return nil
 }
 
 // Query retrieves a list of existing users from the database.
-func (s *Store) Query(ctx context.Context, filter user.QueryFilter, orderBy order.By, pageNumber int, rowsPerPage int) ([]user.User, error) {
+func (s *Store) Query(ctx context.Context, filter user.QueryFilter, fields []string, orderBy []order.By, pageNumber int, rowsPerPage int) ([]user.User, error) {
 	data := map[string]interface{}{
 		"offset":        (pageNumber - 1) * rowsPerPage,
 		"rows_per_page": rowsPerPage,
 	}
 
+	columns, err := selectColumns(fields)
+	if err != nil {
+		return nil, err
+	}
+
 	const q = `
 	SELECT
-		*
+		%s
 	FROM
 		users`
 
-	buf := bytes.NewBufferString(q)
-	s.applyFilter(filter, data, buf)
+	buf := bytes.NewBufferString(fmt.Sprintf(q, columns))
+	if err := s.applyFilter(filter, data, buf); err != nil {
+		return nil, err
+	}
 
 	orderByClause, err := orderByClause(orderBy)
 	if err != nil {
@@ -129,6 +164,96 @@ func (s *Store) Query(ctx context.Context, filter user.QueryFilter, orderBy orde
 	return toCoreUserSlice(dbUsrs), nil
 }
 
+// QuerySeek retrieves the users after the seek, or before it for a
+// backward seek, from the database. Unlike Query, it doesn't skip the rows
+// of the pages before, so it's as fast for the last page as the first.
+func (s *Store) QuerySeek(ctx context.Context, filter user.QueryFilter, fields []string, orderBy []order.By, seek order.Seek, rowsPerPage int) ([]user.User, error) {
+	data := map[string]interface{}{
+		"rows_per_page": rowsPerPage,
+	}
+
+	columns, err := selectColumns(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+	SELECT
+		%s
+	FROM
+		users`
+
+	seekClause, err := keyset.Where(orderBy, seek, data)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBufferString(fmt.Sprintf(q, columns))
+	if err := s.applyFilter(filter, data, buf, seekClause); err != nil {
+		return nil, err
+	}
+
+	orderByClause, err := keyset.OrderBy(orderBy, seek)
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteString(orderByClause)
+	buf.WriteString(" FETCH FIRST :rows_per_page ROWS ONLY")
+
+	var dbUsrs []dbUser
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, buf.String(), data, &dbUsrs); err != nil {
+		return nil, fmt.Errorf("namedqueryslice: %w", err)
+	}
+
+	// A backward seek reads the rows in reverse, so they're put back in
+	// the order asked for.
+	if seek.Backward {
+		slices.Reverse(dbUsrs)
+	}
+
+	return toCoreUserSlice(dbUsrs), nil
+}
+
+// Stream retrieves all the users that match the filter from the database,
+// passing each one to the function as it's read.
+func (s *Store) Stream(ctx context.Context, filter user.QueryFilter, fields []string, orderBy []order.By, fn func(user.User) error) error {
+	data := map[string]interface{}{}
+
+	columns, err := selectColumns(fields)
+	if err != nil {
+		return err
+	}
+
+	const q = `
+	SELECT
+		%s
+	FROM
+		users`
+
+	buf := bytes.NewBufferString(fmt.Sprintf(q, columns))
+	if err := s.applyFilter(filter, data, buf); err != nil {
+		return err
+	}
+
+	orderByClause, err := orderByClause(orderBy)
+	if err != nil {
+		return err
+	}
+
+	buf.WriteString(orderByClause)
+
+	f := func(dbUsr dbUser) error {
+		return fn(toCoreUser(dbUsr))
+	}
+
+	if err := database.NamedQueryStream(ctx, s.log, s.db, buf.String(), data, f); err != nil {
+		return fmt.Errorf("namedquerystream: %w", err)
+	}
+
+	return nil
+}
+
 // Count returns the total number of users in the DB.
 func (s *Store) Count(ctx context.Context, filter user.QueryFilter) (int, error) {
 	data := map[string]interface{}{}
@@ -140,7 +265,9 @@ func (s *Store) Count(ctx context.Context, filter user.QueryFilter) (int, error)
 		users`
 
 	buf := bytes.NewBufferString(q)
-	s.applyFilter(filter, data, buf)
+	if err := s.applyFilter(filter, data, buf); err != nil {
+		return 0, err
+	}
 
 	var count struct {
 		Count int `db:"count"`
@@ -9,10 +9,13 @@ import (
 	"fmt"
 	"github.com/shawnzxx/service/business/data/order"
 	"net/mail"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/shawnzxx/service/business/core/event"
+	"github.com/shawnzxx/service/foundation/web"
+	"go.uber.org/zap"
 )
 
 // Set of error variables for CRUD operations.
@@ -20,6 +23,7 @@ var (
 	ErrNotFound              = errors.New("user not found")
 	ErrUniqueEmail           = errors.New("email is not unique")
 	ErrAuthenticationFailure = errors.New("authentication failed")
+	ErrVersionConflict       = errors.New("user has been modified")
 )
 
 // Storer interface declares the behavior this package needs to persists and retrieve data.
@@ -27,33 +31,56 @@ type Storer interface {
 	Create(ctx context.Context, usr User) error
 	Update(ctx context.Context, usr User) error
 	Delete(ctx context.Context, usr User) error
-	Query(ctx context.Context, filter QueryFilter, orderBy order.By, pageNumber int, rowsPerPage int) ([]User, error)
+	Query(ctx context.Context, filter QueryFilter, fields []string, orderBy []order.By, pageNumber int, rowsPerPage int) ([]User, error)
+	QuerySeek(ctx context.Context, filter QueryFilter, fields []string, orderBy []order.By, seek order.Seek, rowsPerPage int) ([]User, error)
+	Stream(ctx context.Context, filter QueryFilter, fields []string, orderBy []order.By, fn func(User) error) error
 	Count(ctx context.Context, filter QueryFilter) (int, error)
 	QueryByID(ctx context.Context, userID uuid.UUID) (User, error)
 	QueryByIDs(ctx context.Context, userID []uuid.UUID) ([]User, error)
 	QueryByEmail(ctx context.Context, email mail.Address) (User, error)
 }
 
+// Hasher interface declares the behavior this package needs to hash and
+// verify passwords. Verify reports if a matching hash should be replaced with
+// a new one.
+type Hasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(hash []byte, password string) (rehash bool, err error)
+}
+
 // Core manages the set of APIs for user access.
 // We already have user.User struct in model.go.
 // Here we use user.Core to represent the domain APIs.
 type Core struct {
+	log    *zap.SugaredLogger
 	storer Storer
+	hasher Hasher
+	events *event.Bus
+
+	dummyOnce sync.Once
+	dummyHash []byte
 }
 
-// NewCore constructs a core for user api access.
-func NewCore(storer Storer) *Core {
+// NewCore constructs a core for user api access. Changes to users are
+// published to the events bus, which can be nil.
+func NewCore(log *zap.SugaredLogger, storer Storer, hasher Hasher, events *event.Bus) *Core {
 	return &Core{
+		log:    log,
 		storer: storer,
+		hasher: hasher,
+		events: events,
 	}
 }
 
 // Create inserts a new user into the database.
 // Core is API we use pointer semantic, input are using value semantic.
 func (c *Core) Create(ctx context.Context, nu NewUser) (User, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
+	ctx, span := web.AddSpan(ctx, "business.core.user.create")
+	defer span.End()
+
+	hash, err := c.hasher.Hash(nu.Password)
 	if err != nil {
-		return User{}, fmt.Errorf("generatefrompassword: %w", err)
+		return User{}, fmt.Errorf("hash: %w", err)
 	}
 
 	now := time.Now()
@@ -66,6 +93,7 @@ func (c *Core) Create(ctx context.Context, nu NewUser) (User, error) {
 		Roles:        nu.Roles,
 		Department:   nu.Department,
 		Enabled:      true,
+		Version:      1,
 		DateCreated:  now,
 		DateUpdated:  now,
 	}
@@ -74,6 +102,8 @@ func (c *Core) Create(ctx context.Context, nu NewUser) (User, error) {
 		return User{}, fmt.Errorf("create: %w", err)
 	}
 
+	c.publish(event.TypeCreated, usr)
+
 	return usr, nil
 }
 
@@ -83,6 +113,9 @@ func (c *Core) Create(ctx context.Context, nu NewUser) (User, error) {
 // the reason is for efficiency, for business layer most likely you already have User obj
 // we can reuse it to work with UpdateUser, instead of pass in ID and query DB again
 func (c *Core) Update(ctx context.Context, usr User, uu UpdateUser) (User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.update")
+	defer span.End()
+
 	if uu.Name != nil {
 		usr.Name = *uu.Name
 	}
@@ -93,9 +126,9 @@ func (c *Core) Update(ctx context.Context, usr User, uu UpdateUser) (User, error
 		usr.Roles = uu.Roles
 	}
 	if uu.Password != nil {
-		pw, err := bcrypt.GenerateFromPassword([]byte(*uu.Password), bcrypt.DefaultCost)
+		pw, err := c.hasher.Hash(*uu.Password)
 		if err != nil {
-			return User{}, fmt.Errorf("generatefrompassword: %w", err)
+			return User{}, fmt.Errorf("hash: %w", err)
 		}
 		usr.PasswordHash = pw
 	}
@@ -110,22 +143,34 @@ func (c *Core) Update(ctx context.Context, usr User, uu UpdateUser) (User, error
 	if err := c.storer.Update(ctx, usr); err != nil {
 		return User{}, fmt.Errorf("update: %w", err)
 	}
+	usr.Version++
+
+	c.publish(event.TypeUpdated, usr)
 
 	return usr, nil
 }
 
 // Delete removes a user from the database.
 func (c *Core) Delete(ctx context.Context, usr User) error {
+	ctx, span := web.AddSpan(ctx, "business.core.user.delete")
+	defer span.End()
+
 	if err := c.storer.Delete(ctx, usr); err != nil {
 		return fmt.Errorf("delete: %w", err)
 	}
 
+	c.publish(event.TypeDeleted, usr)
+
 	return nil
 }
 
-// Query retrieves a list of existing users from the database.
-func (c *Core) Query(ctx context.Context, filter QueryFilter, orderBy order.By, pageNumber int, rowsPerPage int) ([]User, error) {
-	users, err := c.storer.Query(ctx, filter, orderBy, pageNumber, rowsPerPage)
+// Query retrieves a list of existing users from the database. Only the
+// fields are read when any are given, the others are left empty.
+func (c *Core) Query(ctx context.Context, filter QueryFilter, fields []string, orderBy []order.By, pageNumber int, rowsPerPage int) ([]User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.query")
+	defer span.End()
+
+	users, err := c.storer.Query(ctx, filter, selectFields(fields, orderBy), orderBy, pageNumber, rowsPerPage)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
 	}
@@ -133,13 +178,48 @@ func (c *Core) Query(ctx context.Context, filter QueryFilter, orderBy order.By,
 	return users, nil
 }
 
+// QuerySeek retrieves a page of users that starts after the seek, or
+// ends before it for a backward seek. Only the fields are read when any
+// are given.
+func (c *Core) QuerySeek(ctx context.Context, filter QueryFilter, fields []string, orderBy []order.By, seek order.Seek, rowsPerPage int) ([]User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.queryseek")
+	defer span.End()
+
+	users, err := c.storer.QuerySeek(ctx, filter, selectFields(fields, orderBy), orderBy, seek, rowsPerPage)
+	if err != nil {
+		return nil, fmt.Errorf("queryseek: %w", err)
+	}
+
+	return users, nil
+}
+
+// Stream passes every user that matches the filter to the function, one at
+// a time, without loading the whole result into memory. Only the fields are
+// read when any are given.
+func (c *Core) Stream(ctx context.Context, filter QueryFilter, fields []string, orderBy []order.By, fn func(User) error) error {
+	ctx, span := web.AddSpan(ctx, "business.core.user.stream")
+	defer span.End()
+
+	if err := c.storer.Stream(ctx, filter, selectFields(fields, orderBy), orderBy, fn); err != nil {
+		return fmt.Errorf("stream: %w", err)
+	}
+
+	return nil
+}
+
 // Count returns the total number of users in the store.
 func (c *Core) Count(ctx context.Context, filter QueryFilter) (int, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.count")
+	defer span.End()
+
 	return c.storer.Count(ctx, filter)
 }
 
 // QueryByID gets the specified user from the database.
 func (c *Core) QueryByID(ctx context.Context, userID uuid.UUID) (User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.querybyid")
+	defer span.End()
+
 	user, err := c.storer.QueryByID(ctx, userID)
 	if err != nil {
 		return User{}, fmt.Errorf("query: userID[%s]: %w", userID, err)
@@ -150,6 +230,9 @@ func (c *Core) QueryByID(ctx context.Context, userID uuid.UUID) (User, error) {
 
 // QueryByIDs gets the specified user from the database.
 func (c *Core) QueryByIDs(ctx context.Context, userIDs []uuid.UUID) ([]User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.querybyids")
+	defer span.End()
+
 	user, err := c.storer.QueryByIDs(ctx, userIDs)
 	if err != nil {
 		return nil, fmt.Errorf("query: userIDs[%s]: %w", userIDs, err)
@@ -160,6 +243,9 @@ func (c *Core) QueryByIDs(ctx context.Context, userIDs []uuid.UUID) ([]User, err
 
 // QueryByEmail gets the specified user from the database by email.
 func (c *Core) QueryByEmail(ctx context.Context, email mail.Address) (User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.querybyemail")
+	defer span.End()
+
 	user, err := c.storer.QueryByEmail(ctx, email)
 	if err != nil {
 		return User{}, fmt.Errorf("query: email[%s]: %w", email, err)
@@ -174,14 +260,79 @@ func (c *Core) QueryByEmail(ctx context.Context, email mail.Address) (User, erro
 // success it returns a Claims User representing this user. The claims can be
 // used to generate a token for future authentication.
 func (c *Core) Authenticate(ctx context.Context, email mail.Address, password string) (User, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.user.authenticate")
+	defer span.End()
+
 	usr, err := c.QueryByEmail(ctx, email)
 	if err != nil {
+		// A password is still verified, so it takes as long to find out
+		// there's no user with the email as that the password is wrong.
+		if errors.Is(err, ErrNotFound) {
+			c.hasher.Verify(c.dummy(), password)
+		}
 		return User{}, fmt.Errorf("query: email[%s]: %w", email, err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(password)); err != nil {
-		return User{}, fmt.Errorf("comparehashandpassword: %w", ErrAuthenticationFailure)
+	rehash, err := c.hasher.Verify(usr.PasswordHash, password)
+	if err != nil {
+		return User{}, fmt.Errorf("verify: %w: %w", ErrAuthenticationFailure, err)
+	}
+
+	// Hashes made by an older algorithm, or with weaker parameters, are
+	// replaced now that we know the password. A failure here must not fail
+	// the login, the hash will be upgraded on a later attempt.
+	if rehash {
+		if err := c.rehash(ctx, &usr, password); err != nil {
+			c.log.Errorw("authenticate: rehash", "userID", usr.ID, "ERROR", err)
+		}
 	}
 
 	return usr, nil
 }
+
+// dummy returns a hash made by the current algorithm, which passwords are
+// verified against when there's no user to verify them for.
+func (c *Core) dummy() []byte {
+	c.dummyOnce.Do(func() {
+		hash, err := c.hasher.Hash("dummy password")
+		if err != nil {
+			c.log.Errorw("authenticate: dummy hash", "ERROR", err)
+			return
+		}
+		c.dummyHash = hash
+	})
+
+	return c.dummyHash
+}
+
+// rehash replaces the stored password hash of the user with a hash made by
+// the current algorithm.
+func (c *Core) rehash(ctx context.Context, usr *User, password string) error {
+	hash, err := c.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("hash: %w", err)
+	}
+
+	upd := *usr
+	upd.PasswordHash = hash
+
+	if err := c.storer.Update(ctx, upd); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	usr.PasswordHash = hash
+	usr.Version = upd.Version + 1
+
+	return nil
+}
+
+// publish tells the subscribers of the events bus about a change to the
+// user. A user owns itself.
+func (c *Core) publish(typ string, usr User) {
+	c.events.Publish(event.Event{
+		Source:   event.SourceUser,
+		Type:     typ,
+		EntityID: usr.ID.String(),
+		OwnerID:  usr.ID.String(),
+	})
+}
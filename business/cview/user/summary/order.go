@@ -1,6 +1,9 @@
 package summary
 
-import "github.com/shawnzxx/service/business/data/order"
+import (
+	"github.com/google/uuid"
+	"github.com/shawnzxx/service/business/data/order"
+)
 
 // DefaultOrderBy represents the default way we sort.
 var DefaultOrderBy = order.NewBy(OrderByUserID, order.ASC)
@@ -11,3 +14,30 @@ const (
 	OrderByUserID   = "userid"
 	OrderByUserName = "userName"
 )
+
+// SeekAfter returns the seek that starts results ordered by the fields after
+// the summary.
+func SeekAfter(smm Summary, orderBy []order.By) order.Seek {
+	return order.NewSeek(orderBy, OrderByUserID, func(field string) string {
+		switch field {
+		case OrderByUserName:
+			return smm.UserName
+		default:
+			return smm.UserID.String()
+		}
+	})
+}
+
+// CheckSeek checks a seek read from a client, which must hold the values
+// SeekAfter would for the fields.
+func CheckSeek(seek order.Seek, orderBy []order.By) error {
+	return seek.Check(orderBy, OrderByUserID, func(field string, value string) error {
+		switch field {
+		case OrderByUserID:
+			_, err := uuid.Parse(value)
+			return err
+		default:
+			return nil
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package summarydb
+
+import (
+	"github.com/google/uuid"
+	"github.com/shawnzxx/service/business/cview/user/summary"
+)
+
+// dbSummary represents a row of the user_summary view.
+type dbSummary struct {
+	UserID     uuid.UUID `db:"user_id"`
+	UserName   string    `db:"user_name"`
+	TotalCount int       `db:"total_count"`
+	TotalCost  float64   `db:"total_cost"`
+}
+
+func toCoreSummary(dbSmm dbSummary) summary.Summary {
+	return summary.Summary{
+		UserID:     dbSmm.UserID,
+		UserName:   dbSmm.UserName,
+		TotalCount: dbSmm.TotalCount,
+		TotalCost:  dbSmm.TotalCost,
+	}
+}
+
+func toCoreSummarySlice(dbSummaries []dbSummary) []summary.Summary {
+	smms := make([]summary.Summary, len(dbSummaries))
+	for i, dbSmm := range dbSummaries {
+		smms[i] = toCoreSummary(dbSmm)
+	}
+	return smms
+}
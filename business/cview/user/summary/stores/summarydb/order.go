@@ -0,0 +1,22 @@
+package summarydb
+
+import (
+	"github.com/shawnzxx/service/business/cview/user/summary"
+	"github.com/shawnzxx/service/business/data/order"
+)
+
+// keyset describes the columns summaries are ordered by.
+var keyset = order.Keyset{
+	Key: summary.OrderByUserID,
+	Columns: map[string]order.Column{
+		summary.OrderByUserID:   {Name: "user_id", Type: "uuid"},
+		summary.OrderByUserName: {Name: "user_name", Type: "text"},
+	},
+}
+
+// orderByClause returns the ORDER BY clause for the fields. Rows that are
+// equal on all the fields are ordered by the primary key, so the order is
+// the same every time the query runs.
+func orderByClause(orderBy []order.By) (string, error) {
+	return keyset.OrderBy(orderBy, order.Seek{})
+}
@@ -0,0 +1,160 @@
+// Package summarydb provides access to the user summary view.
+package summarydb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/shawnzxx/service/business/cview/user/summary"
+	"github.com/shawnzxx/service/business/data/order"
+	database "github.com/shawnzxx/service/business/sys/database/pgx"
+	"go.uber.org/zap"
+)
+
+// Store manages the set of APIs for summary view database access.
+type Store struct {
+	log *zap.SugaredLogger
+	db  *sqlx.DB
+}
+
+// NewStore constructs the api for data access.
+func NewStore(log *zap.SugaredLogger, db *sqlx.DB) *Store {
+	return &Store{
+		log: log,
+		db:  db,
+	}
+}
+
+// Query retrieves a list of existing summaries from the database.
+func (s *Store) Query(ctx context.Context, filter summary.QueryFilter, orderBy []order.By, pageNumber int, rowsPerPage int) ([]summary.Summary, error) {
+	data := map[string]interface{}{
+		"offset":        (pageNumber - 1) * rowsPerPage,
+		"rows_per_page": rowsPerPage,
+	}
+
+	const q = `
+	SELECT
+		user_id, user_name, total_count, total_cost
+	FROM
+		user_summary`
+
+	buf := bytes.NewBufferString(q)
+	s.applyFilter(filter, data, buf)
+
+	orderByClause, err := orderByClause(orderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteString(orderByClause)
+	buf.WriteString(" OFFSET :offset ROWS FETCH NEXT :rows_per_page ROWS ONLY")
+
+	var dbSmms []dbSummary
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, buf.String(), data, &dbSmms); err != nil {
+		return nil, fmt.Errorf("namedqueryslice: %w", err)
+	}
+
+	return toCoreSummarySlice(dbSmms), nil
+}
+
+// QuerySeek retrieves the summaries after the seek, or before it for a
+// backward seek, from the database. Unlike Query, it doesn't skip the rows
+// of the pages before, so it's as fast for the last page as the first.
+func (s *Store) QuerySeek(ctx context.Context, filter summary.QueryFilter, orderBy []order.By, seek order.Seek, rowsPerPage int) ([]summary.Summary, error) {
+	data := map[string]interface{}{
+		"rows_per_page": rowsPerPage,
+	}
+
+	const q = `
+	SELECT
+		user_id, user_name, total_count, total_cost
+	FROM
+		user_summary`
+
+	seekClause, err := keyset.Where(orderBy, seek, data)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBufferString(q)
+	s.applyFilter(filter, data, buf, seekClause)
+
+	orderByClause, err := keyset.OrderBy(orderBy, seek)
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteString(orderByClause)
+	buf.WriteString(" FETCH FIRST :rows_per_page ROWS ONLY")
+
+	var dbSmms []dbSummary
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, buf.String(), data, &dbSmms); err != nil {
+		return nil, fmt.Errorf("namedqueryslice: %w", err)
+	}
+
+	// A backward seek reads the rows in reverse, so they're put back in
+	// the order asked for.
+	if seek.Backward {
+		slices.Reverse(dbSmms)
+	}
+
+	return toCoreSummarySlice(dbSmms), nil
+}
+
+// Stream retrieves all the summaries that match the filter from the
+// database, passing each one to the function as it's read.
+func (s *Store) Stream(ctx context.Context, filter summary.QueryFilter, orderBy []order.By, fn func(summary.Summary) error) error {
+	data := map[string]interface{}{}
+
+	const q = `
+	SELECT
+		user_id, user_name, total_count, total_cost
+	FROM
+		user_summary`
+
+	buf := bytes.NewBufferString(q)
+	s.applyFilter(filter, data, buf)
+
+	orderByClause, err := orderByClause(orderBy)
+	if err != nil {
+		return err
+	}
+
+	buf.WriteString(orderByClause)
+
+	f := func(dbSmm dbSummary) error {
+		return fn(toCoreSummary(dbSmm))
+	}
+
+	if err := database.NamedQueryStream(ctx, s.log, s.db, buf.String(), data, f); err != nil {
+		return fmt.Errorf("namedquerystream: %w", err)
+	}
+
+	return nil
+}
+
+// Count returns the total number of summaries in the DB.
+func (s *Store) Count(ctx context.Context, filter summary.QueryFilter) (int, error) {
+	data := map[string]interface{}{}
+
+	const q = `
+	SELECT
+		count(1)
+	FROM
+		user_summary`
+
+	buf := bytes.NewBufferString(q)
+	s.applyFilter(filter, data, buf)
+
+	var count struct {
+		Count int `db:"count"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, buf.String(), data, &count); err != nil {
+		return 0, fmt.Errorf("namedquerystruct: %w", err)
+	}
+
+	return count.Count, nil
+}
@@ -6,12 +6,15 @@ import (
 	"context"
 	"fmt"
 	"github.com/shawnzxx/service/business/data/order"
+	"github.com/shawnzxx/service/foundation/web"
 )
 
 // Storer interface declares the behavior this package needs to perists and
 // retrieve data.
 type Storer interface {
-	Query(ctx context.Context, filter QueryFilter, orderBy order.By, pageNumber int, rowsPerPage int) ([]Summary, error)
+	Query(ctx context.Context, filter QueryFilter, orderBy []order.By, pageNumber int, rowsPerPage int) ([]Summary, error)
+	QuerySeek(ctx context.Context, filter QueryFilter, orderBy []order.By, seek order.Seek, rowsPerPage int) ([]Summary, error)
+	Stream(ctx context.Context, filter QueryFilter, orderBy []order.By, fn func(Summary) error) error
 	Count(ctx context.Context, filter QueryFilter) (int, error)
 }
 
@@ -28,7 +31,10 @@ func NewCore(storer Storer) *Core {
 }
 
 // Query retrieves a list of existing users from the database.
-func (c *Core) Query(ctx context.Context, filter QueryFilter, orderBy order.By, pageNumber int, rowsPerPage int) ([]Summary, error) {
+func (c *Core) Query(ctx context.Context, filter QueryFilter, orderBy []order.By, pageNumber int, rowsPerPage int) ([]Summary, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.summary.query")
+	defer span.End()
+
 	users, err := c.storer.Query(ctx, filter, orderBy, pageNumber, rowsPerPage)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
@@ -37,7 +43,37 @@ func (c *Core) Query(ctx context.Context, filter QueryFilter, orderBy order.By,
 	return users, nil
 }
 
+// QuerySeek retrieves a page of summaries that starts after the seek, or
+// ends before it for a backward seek.
+func (c *Core) QuerySeek(ctx context.Context, filter QueryFilter, orderBy []order.By, seek order.Seek, rowsPerPage int) ([]Summary, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.summary.queryseek")
+	defer span.End()
+
+	users, err := c.storer.QuerySeek(ctx, filter, orderBy, seek, rowsPerPage)
+	if err != nil {
+		return nil, fmt.Errorf("queryseek: %w", err)
+	}
+
+	return users, nil
+}
+
+// Stream passes every summary that matches the filter to the function, one
+// at a time, without loading the whole result into memory.
+func (c *Core) Stream(ctx context.Context, filter QueryFilter, orderBy []order.By, fn func(Summary) error) error {
+	ctx, span := web.AddSpan(ctx, "business.core.summary.stream")
+	defer span.End()
+
+	if err := c.storer.Stream(ctx, filter, orderBy, fn); err != nil {
+		return fmt.Errorf("stream: %w", err)
+	}
+
+	return nil
+}
+
 // Count returns the total number of users in the store.
 func (c *Core) Count(ctx context.Context, filter QueryFilter) (int, error) {
+	ctx, span := web.AddSpan(ctx, "business.core.summary.count")
+	defer span.End()
+
 	return c.storer.Count(ctx, filter)
 }
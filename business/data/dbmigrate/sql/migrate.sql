@@ -43,3 +43,20 @@ JOIN
     products AS p ON p.user_id = u.user_id
 GROUP BY
     u.user_id
+
+-- Version: 1.04
+-- Description: Add multi-factor authentication to users
+ALTER TABLE users
+	ADD COLUMN mfa_secret         TEXT    NULL,
+	ADD COLUMN mfa_enabled        BOOLEAN NOT NULL DEFAULT false,
+	ADD COLUMN mfa_recovery_codes TEXT[]  NULL;
+
+-- Version: 1.05
+-- Description: Add row versions to users for optimistic concurrency
+ALTER TABLE users
+	ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+-- Version: 1.06
+-- Description: Add the last accepted TOTP step to users to reject reused codes
+ALTER TABLE users
+	ADD COLUMN mfa_last_step BIGINT NOT NULL DEFAULT 0;
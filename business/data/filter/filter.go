@@ -0,0 +1,180 @@
+// Package filter provides support for filtering query results with
+// operators, like cost[gte]=10 or roles[in]=ADMIN,USER.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shawnzxx/service/business/sys/validate"
+)
+
+// Set of operators a field can be compared with.
+const (
+	EQ    = "eq"
+	NE    = "ne"
+	GT    = "gt"
+	GTE   = "gte"
+	LT    = "lt"
+	LTE   = "lte"
+	IN    = "in"
+	LIKE  = "like"
+	ILIKE = "ilike"
+)
+
+// Condition compares a field with a value using an operator. The IN
+// operator has a list of values, the others have one.
+type Condition struct {
+	Field    string
+	Operator string
+	Values   []string
+}
+
+// =============================================================================
+
+// Field describes a field results can be filtered on: the operators it
+// allows, and how its values are parsed. Parse checks a value and returns
+// it in the form the store expects. Values are used as is when it's nil.
+type Field struct {
+	Operators []string
+	Parse     func(value string) (string, error)
+}
+
+// Fields holds the fields of a domain results can be filtered on.
+type Fields map[string]Field
+
+// Names returns the names of the fields with their operators, like
+// cost[eq|gte], for describing the filters.
+func (f Fields) Names() []string {
+	names := make([]string, 0, len(f))
+	for name, field := range f {
+		names = append(names, name+"["+strings.Join(field.Operators, "|")+"]")
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// UUID parses the value of a field holding ids.
+func UUID(value string) (string, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// Number parses the value of a field holding numbers.
+func Number(value string) (string, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a number", value)
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64), nil
+}
+
+// Integer parses the value of a field holding whole numbers.
+func Integer(value string) (string, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("%q is not an integer", value)
+	}
+	return strconv.Itoa(n), nil
+}
+
+// Bool parses the value of a field holding booleans.
+func Bool(value string) (string, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a boolean", value)
+	}
+	return strconv.FormatBool(b), nil
+}
+
+// Time parses the value of a field holding times, in RFC3339. They're
+// returned in UTC, which is how times are stored.
+func Time(value string) (string, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format("2006-01-02 15:04:05.999999"), nil
+}
+
+// =============================================================================
+
+// key matches the query string keys of filters, like cost[gte].
+var key = regexp.MustCompile(`^([A-Za-z_]+)\[([a-z]+)\]$`)
+
+// Parse constructs the conditions from the query string keys in the form
+// of "field[operator]". The values of the IN operator are separated by
+// commas. Keys in any other form are left to the caller.
+func Parse(r *http.Request, fields Fields) ([]Condition, error) {
+	values := r.URL.Query()
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var conds []Condition
+
+	for _, k := range keys {
+		m := key.FindStringSubmatch(k)
+		if m == nil {
+			continue
+		}
+		name, op := m[1], m[2]
+
+		field, exists := fields[name]
+		if !exists {
+			return nil, validate.NewFieldsError(k, fmt.Errorf("unknown filter field %q", name))
+		}
+
+		if !slices.Contains(field.Operators, op) {
+			return nil, validate.NewFieldsError(k, fmt.Errorf("operator %q isn't allowed, use one of %s", op, strings.Join(field.Operators, ", ")))
+		}
+
+		for _, v := range values[k] {
+			list := []string{v}
+			if op == IN {
+				list = strings.Split(v, ",")
+			}
+
+			cond := Condition{
+				Field:    name,
+				Operator: op,
+				Values:   make([]string, len(list)),
+			}
+
+			for i, value := range list {
+				value = strings.TrimSpace(value)
+				if value == "" {
+					return nil, validate.NewFieldsError(k, errors.New("empty value"))
+				}
+
+				if field.Parse != nil {
+					var err error
+					if value, err = field.Parse(value); err != nil {
+						return nil, validate.NewFieldsError(k, err)
+					}
+				}
+
+				cond.Values[i] = value
+			}
+
+			conds = append(conds, cond)
+		}
+	}
+
+	return conds, nil
+}
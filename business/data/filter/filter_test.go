@@ -0,0 +1,276 @@
+package filter_test
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/shawnzxx/service/business/data/filter"
+	"github.com/shawnzxx/service/business/sys/database/pgx/dbarray"
+	"github.com/shawnzxx/service/business/sys/validate"
+)
+
+var fields = filter.Fields{
+	"cost": {
+		Operators: []string{filter.EQ, filter.GTE, filter.LT},
+		Parse:     filter.Number,
+	},
+	"quantity": {
+		Operators: []string{filter.EQ, filter.IN},
+		Parse:     filter.Integer,
+	},
+	"name": {
+		Operators: []string{filter.LIKE, filter.ILIKE},
+	},
+	"roles": {
+		Operators: []string{filter.EQ, filter.NE, filter.IN},
+	},
+}
+
+// TestParse checks the query string keys are parsed into conditions, and
+// fields and operators that aren't declared are rejected with the key.
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		conds []filter.Condition
+		field string
+	}{
+		{
+			name:  "operators",
+			query: "cost[gte]=10&cost[lt]=20.50&name[ilike]=gop",
+			conds: []filter.Condition{
+				{Field: "cost", Operator: filter.GTE, Values: []string{"10"}},
+				{Field: "cost", Operator: filter.LT, Values: []string{"20.5"}},
+				{Field: "name", Operator: filter.ILIKE, Values: []string{"gop"}},
+			},
+		},
+		{
+			name:  "in",
+			query: "quantity[in]=1,%202,3",
+			conds: []filter.Condition{
+				{Field: "quantity", Operator: filter.IN, Values: []string{"1", "2", "3"}},
+			},
+		},
+		{
+			name:  "repeated",
+			query: "roles[ne]=ADMIN&roles[ne]=USER",
+			conds: []filter.Condition{
+				{Field: "roles", Operator: filter.NE, Values: []string{"ADMIN"}},
+				{Field: "roles", Operator: filter.NE, Values: []string{"USER"}},
+			},
+		},
+		{
+			name:  "other keys",
+			query: "name=gop&page=2&orderBy=name,ASC",
+		},
+		{
+			name:  "operator not allowed",
+			query: "cost[like]=1",
+			field: "cost[like]",
+		},
+		{
+			name:  "unknown operator",
+			query: "cost[between]=1",
+			field: "cost[between]",
+		},
+		{
+			name:  "unknown field",
+			query: "password_hash[like]=a",
+			field: "password_hash[like]",
+		},
+		{
+			name:  "value not parsed",
+			query: "cost[eq]=1%3BDROP%20TABLE%20users",
+			field: "cost[eq]",
+		},
+		{
+			name:  "empty value",
+			query: "quantity[in]=1,,2",
+			field: "quantity[in]",
+		},
+		{
+			name:  "injection in a list",
+			query: "quantity[in]=1,2)%20OR%201=1--",
+			field: "quantity[in]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+			conds, err := filter.Parse(r, fields)
+
+			if tt.field != "" {
+				fe := validate.GetFieldErrors(err)
+				if len(fe) != 1 || fe[0].Field != tt.field {
+					t.Fatalf("Should fail with a field error for %q, got %v.", tt.field, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Should be able to parse the filter: %s", err)
+			}
+
+			if !reflect.DeepEqual(conds, tt.conds) {
+				t.Errorf("Should get the conditions %v, got %v.", tt.conds, conds)
+			}
+		})
+	}
+}
+
+// TestWhere checks the conditions compile to SQL that only holds named
+// parameters, with the values passed in the data.
+func TestWhere(t *testing.T) {
+	columns := filter.Columns{
+		"cost":     {Name: "cost", Type: "numeric"},
+		"quantity": {Name: "quantity", Type: "int"},
+		"name":     {Name: "name", Type: "text"},
+		"roles":    {Name: "roles", Type: "text", Array: true},
+	}
+
+	tests := []struct {
+		name  string
+		cond  filter.Condition
+		where string
+		value any
+		fail  bool
+	}{
+		{
+			name:  "eq",
+			cond:  filter.Condition{Field: "cost", Operator: filter.EQ, Values: []string{"10"}},
+			where: "cost = CAST(:filter_0 AS numeric)",
+			value: "10",
+		},
+		{
+			name:  "ne",
+			cond:  filter.Condition{Field: "cost", Operator: filter.NE, Values: []string{"10"}},
+			where: "cost IS DISTINCT FROM CAST(:filter_0 AS numeric)",
+			value: "10",
+		},
+		{
+			name:  "gte",
+			cond:  filter.Condition{Field: "cost", Operator: filter.GTE, Values: []string{"10"}},
+			where: "cost >= CAST(:filter_0 AS numeric)",
+			value: "10",
+		},
+		{
+			name:  "lt",
+			cond:  filter.Condition{Field: "quantity", Operator: filter.LT, Values: []string{"5"}},
+			where: "quantity < CAST(:filter_0 AS int)",
+			value: "5",
+		},
+		{
+			name:  "in",
+			cond:  filter.Condition{Field: "quantity", Operator: filter.IN, Values: []string{"1", "2"}},
+			where: "quantity = ANY(CAST(:filter_0 AS int[]))",
+			value: dbarray.Array([]string{"1", "2"}),
+		},
+		{
+			name:  "like",
+			cond:  filter.Condition{Field: "name", Operator: filter.LIKE, Values: []string{"gop"}},
+			where: "name LIKE :filter_0",
+			value: "%gop%",
+		},
+		{
+			name:  "ilike escapes wildcards",
+			cond:  filter.Condition{Field: "name", Operator: filter.ILIKE, Values: []string{`100%_\'`}},
+			where: "name ILIKE :filter_0",
+			value: `%100\%\_\\'%`,
+		},
+		{
+			name:  "array eq",
+			cond:  filter.Condition{Field: "roles", Operator: filter.EQ, Values: []string{"ADMIN"}},
+			where: "CAST(:filter_0 AS text) = ANY(roles)",
+			value: "ADMIN",
+		},
+		{
+			name:  "array ne",
+			cond:  filter.Condition{Field: "roles", Operator: filter.NE, Values: []string{"ADMIN"}},
+			where: "NOT (CAST(:filter_0 AS text) = ANY(roles))",
+			value: "ADMIN",
+		},
+		{
+			name:  "array in",
+			cond:  filter.Condition{Field: "roles", Operator: filter.IN, Values: []string{"ADMIN", "USER"}},
+			where: "roles && CAST(:filter_0 AS text[])",
+			value: dbarray.Array([]string{"ADMIN", "USER"}),
+		},
+		{
+			name: "array like",
+			cond: filter.Condition{Field: "roles", Operator: filter.LIKE, Values: []string{"AD"}},
+			fail: true,
+		},
+		{
+			name: "unknown field",
+			cond: filter.Condition{Field: "password_hash", Operator: filter.EQ, Values: []string{"x"}},
+			fail: true,
+		},
+		{
+			name: "unknown operator",
+			cond: filter.Condition{Field: "cost", Operator: "between", Values: []string{"1"}},
+			fail: true,
+		},
+		{
+			name: "many values",
+			cond: filter.Condition{Field: "cost", Operator: filter.EQ, Values: []string{"1", "2"}},
+			fail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]any{}
+
+			wc, err := columns.Where([]filter.Condition{tt.cond}, data)
+
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("Should fail to compile the condition, got %v.", wc)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Should be able to compile the condition: %s", err)
+			}
+
+			if len(wc) != 1 || wc[0] != tt.where {
+				t.Errorf("Should get the condition %q, got %q.", tt.where, wc)
+			}
+
+			if !reflect.DeepEqual(data["filter_0"], tt.value) {
+				t.Errorf("Should pass the value %#v, got %#v.", tt.value, data["filter_0"])
+			}
+		})
+	}
+}
+
+// TestWhereParams checks each condition gets a parameter of its own.
+func TestWhereParams(t *testing.T) {
+	columns := filter.Columns{
+		"cost": {Name: "cost", Type: "numeric"},
+	}
+
+	conds := []filter.Condition{
+		{Field: "cost", Operator: filter.GTE, Values: []string{"10"}},
+		{Field: "cost", Operator: filter.LT, Values: []string{"20"}},
+	}
+
+	data := map[string]any{}
+	wc, err := columns.Where(conds, data)
+	if err != nil {
+		t.Fatalf("Should be able to compile the conditions: %s", err)
+	}
+
+	want := []string{"cost >= CAST(:filter_0 AS numeric)", "cost < CAST(:filter_1 AS numeric)"}
+	if !reflect.DeepEqual(wc, want) {
+		t.Errorf("Should get the conditions %q, got %q.", want, wc)
+	}
+
+	if data["filter_0"] != "10" || data["filter_1"] != "20" {
+		t.Errorf("Should pass the values of both conditions, got %v.", data)
+	}
+}
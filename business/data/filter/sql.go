@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shawnzxx/service/business/sys/database/pgx/dbarray"
+)
+
+// Column describes the column of the database a field is filtered on. The
+// values are cast to its type, since they're kept as strings. Array is set
+// for columns holding a list of values of the type, which match when any
+// of the values does.
+type Column struct {
+	Name  string
+	Type  string
+	Array bool
+}
+
+// Columns maps the fields of a domain results can be filtered on to their
+// columns.
+type Columns map[string]Column
+
+// Where compiles the conditions into conditions of a WHERE clause. Values
+// are only ever passed as named parameters, added to data, so they can't
+// change the statement.
+func (c Columns) Where(conds []Condition, data map[string]any) ([]string, error) {
+	wc := make([]string, 0, len(conds))
+
+	for i, cond := range conds {
+		col, exists := c[cond.Field]
+		if !exists {
+			return nil, fmt.Errorf("field %q does not exist", cond.Field)
+		}
+
+		param := fmt.Sprintf("filter_%d", i)
+		value := fmt.Sprintf("CAST(:%s AS %s)", param, col.Type)
+		list := fmt.Sprintf("CAST(:%s AS %s[])", param, col.Type)
+
+		if cond.Operator == IN {
+			data[param] = dbarray.Array(cond.Values)
+		} else {
+			if len(cond.Values) != 1 {
+				return nil, fmt.Errorf("field %q: operator %q takes one value", cond.Field, cond.Operator)
+			}
+			data[param] = cond.Values[0]
+		}
+
+		var w string
+		switch {
+		case col.Array && cond.Operator == EQ:
+			w = value + " = ANY(" + col.Name + ")"
+		case col.Array && cond.Operator == NE:
+			w = "NOT (" + value + " = ANY(" + col.Name + "))"
+		case col.Array && cond.Operator == IN:
+			w = col.Name + " && " + list
+		case col.Array:
+			return nil, fmt.Errorf("field %q: operator %q isn't supported on lists", cond.Field, cond.Operator)
+
+		case cond.Operator == IN:
+			w = col.Name + " = ANY(" + list + ")"
+		case cond.Operator == LIKE || cond.Operator == ILIKE:
+			data[param] = "%" + escapeLike(cond.Values[0]) + "%"
+			w = col.Name + " " + strings.ToUpper(cond.Operator) + " :" + param
+
+		default:
+			op, exists := comparisons[cond.Operator]
+			if !exists {
+				return nil, fmt.Errorf("field %q: unknown operator %q", cond.Field, cond.Operator)
+			}
+			w = col.Name + " " + op + " " + value
+		}
+
+		wc = append(wc, w)
+	}
+
+	return wc, nil
+}
+
+var comparisons = map[string]string{
+	EQ:  "=",
+	NE:  "IS DISTINCT FROM",
+	GT:  ">",
+	GTE: ">=",
+	LT:  "<",
+	LTE: "<=",
+}
+
+// escapeLike escapes the wildcards of LIKE, so the value is matched as
+// text anywhere in the column.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
@@ -0,0 +1,201 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Seek locates a row in ordered results by the values of its order fields,
+// followed by the value of its key when the key isn't one of the fields.
+// Results start after the row, or end before it when Backward is set.
+type Seek struct {
+	Values   []string
+	Backward bool
+}
+
+// NewSeek constructs the seek that starts results after a row. The value
+// function returns the value of a field of the row, in the form the
+// database accepts for the type of the column.
+func NewSeek(orderBy []By, key string, value func(field string) string) Seek {
+	var values []string
+	for _, field := range fields(orderBy, key) {
+		values = append(values, value(field.Field))
+	}
+
+	return Seek{
+		Values: values,
+	}
+}
+
+// Check checks a seek read from a client before it reaches the database. It
+// must hold a value for each of the fields and the key, and each value must
+// be text the database accepts and parse for its field.
+func (s Seek) Check(orderBy []By, key string, parse func(field string, value string) error) error {
+	bys := fields(orderBy, key)
+	if len(s.Values) != len(bys) {
+		return fmt.Errorf("has %d values for %d fields", len(s.Values), len(bys))
+	}
+
+	for i, by := range bys {
+		value := s.Values[i]
+		if !utf8.ValidString(value) || strings.ContainsRune(value, 0) {
+			return fmt.Errorf("value for %s: %w", by.Field, errors.New("not valid text"))
+		}
+
+		if err := parse(by.Field, value); err != nil {
+			return fmt.Errorf("value for %s: %w", by.Field, err)
+		}
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// Column describes the column of the database a field is ordered by. The
+// values of a seek are cast to its type, since they're kept as strings.
+type Column struct {
+	Name string
+	Type string
+}
+
+// Keyset describes how the fields of a domain are ordered in the database.
+// Key is the field of the primary key, which breaks ties between rows that
+// are equal on all the fields so the order is the same every time a query
+// runs.
+type Keyset struct {
+	Key     string
+	Columns map[string]Column
+}
+
+// OrderBy returns the ORDER BY clause for the fields. The order is reversed
+// for a backward seek.
+func (k Keyset) OrderBy(orderBy []By, seek Seek) (string, error) {
+	cols, err := k.columns(orderBy, seek.Backward)
+	if err != nil {
+		return "", err
+	}
+
+	clauses := make([]string, len(cols))
+	for i, col := range cols {
+		clauses[i] = col.Name + " " + col.direction
+	}
+
+	return " ORDER BY " + strings.Join(clauses, ", "), nil
+}
+
+// Where returns the condition that selects the rows after the seek, or
+// before it for a backward seek. The values are added to data as named
+// parameters.
+func (k Keyset) Where(orderBy []By, seek Seek, data map[string]any) (string, error) {
+	cols, err := k.columns(orderBy, seek.Backward)
+	if err != nil {
+		return "", err
+	}
+
+	if len(seek.Values) != len(cols) {
+		return "", fmt.Errorf("seek has %d values for %d columns", len(seek.Values), len(cols))
+	}
+
+	names := make([]string, len(cols))
+	params := make([]string, len(cols))
+	uniform := true
+
+	for i, col := range cols {
+		param := fmt.Sprintf("seek_%d", i)
+		data[param] = seek.Values[i]
+
+		names[i] = col.Name
+		params[i] = fmt.Sprintf("CAST(:%s AS %s)", param, col.Type)
+
+		if col.direction != cols[0].direction {
+			uniform = false
+		}
+	}
+
+	// When all the columns are ordered the same way a row comparison
+	// does, which the database can answer from an index on the columns.
+	if uniform {
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(names, ", "), operator(cols[0].direction), strings.Join(params, ", ")), nil
+	}
+
+	// Otherwise a row comes after the seek when it's equal on the first
+	// columns and after it on the next one.
+	ors := make([]string, len(cols))
+	for i, col := range cols {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, names[j]+" = "+params[j])
+		}
+		ands = append(ands, names[i]+" "+operator(col.direction)+" "+params[i])
+
+		ors[i] = "(" + strings.Join(ands, " AND ") + ")"
+	}
+
+	return "(" + strings.Join(ors, " OR ") + ")", nil
+}
+
+// column is a column with the direction it's ordered in.
+type column struct {
+	Column
+	direction string
+}
+
+// columns returns the columns for the fields, followed by the key.
+func (k Keyset) columns(orderBy []By, backward bool) ([]column, error) {
+	bys := fields(orderBy, k.Key)
+
+	cols := make([]column, len(bys))
+	for i, by := range bys {
+		col, exists := k.Columns[by.Field]
+		if !exists {
+			return nil, fmt.Errorf("field %q does not exist", by.Field)
+		}
+
+		direction := by.Direction
+		if backward {
+			direction = reverse(direction)
+		}
+
+		cols[i] = column{Column: col, direction: direction}
+	}
+
+	return cols, nil
+}
+
+// fields returns the fields followed by the key, when it isn't one of
+// them. The key is ordered in the direction of the last field, so the
+// direction of all the fields is more often the same.
+func fields(orderBy []By, key string) []By {
+	for _, by := range orderBy {
+		if by.Field == key {
+			return orderBy
+		}
+	}
+
+	direction := ASC
+	if len(orderBy) > 0 {
+		direction = orderBy[len(orderBy)-1].Direction
+	}
+
+	bys := make([]By, len(orderBy), len(orderBy)+1)
+	copy(bys, orderBy)
+
+	return append(bys, NewBy(key, direction))
+}
+
+func reverse(direction string) string {
+	if direction == DESC {
+		return ASC
+	}
+	return DESC
+}
+
+func operator(direction string) string {
+	if direction == DESC {
+		return "<"
+	}
+	return ">"
+}
@@ -0,0 +1,185 @@
+package order_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/shawnzxx/service/business/data/order"
+)
+
+var keyset = order.Keyset{
+	Key: "userID",
+	Columns: map[string]order.Column{
+		"userID":      {Name: "user_id", Type: "uuid"},
+		"name":        {Name: "name", Type: "text"},
+		"dateCreated": {Name: "date_created", Type: "timestamptz"},
+	},
+}
+
+// TestKeysetWhere checks the seek compiles to a condition that only holds
+// named parameters, with the values passed in the data.
+func TestKeysetWhere(t *testing.T) {
+	tests := []struct {
+		name     string
+		orderBy  []order.By
+		seek     order.Seek
+		where    string
+		orderSQL string
+	}{
+		{
+			name:     "ascending",
+			orderBy:  []order.By{order.NewBy("name", order.ASC)},
+			seek:     order.Seek{Values: []string{"Bill", "id"}},
+			where:    "(name, user_id) > (CAST(:seek_0 AS text), CAST(:seek_1 AS uuid))",
+			orderSQL: " ORDER BY name ASC, user_id ASC",
+		},
+		{
+			name:     "descending",
+			orderBy:  []order.By{order.NewBy("name", order.DESC)},
+			seek:     order.Seek{Values: []string{"Bill", "id"}},
+			where:    "(name, user_id) < (CAST(:seek_0 AS text), CAST(:seek_1 AS uuid))",
+			orderSQL: " ORDER BY name DESC, user_id DESC",
+		},
+		{
+			name:     "backward",
+			orderBy:  []order.By{order.NewBy("name", order.ASC)},
+			seek:     order.Seek{Values: []string{"Bill", "id"}, Backward: true},
+			where:    "(name, user_id) < (CAST(:seek_0 AS text), CAST(:seek_1 AS uuid))",
+			orderSQL: " ORDER BY name DESC, user_id DESC",
+		},
+		{
+			name:     "key in fields",
+			orderBy:  []order.By{order.NewBy("userID", order.DESC)},
+			seek:     order.Seek{Values: []string{"id"}},
+			where:    "(user_id) < (CAST(:seek_0 AS uuid))",
+			orderSQL: " ORDER BY user_id DESC",
+		},
+		{
+			name:     "mixed",
+			orderBy:  []order.By{order.NewBy("name", order.ASC), order.NewBy("dateCreated", order.DESC)},
+			seek:     order.Seek{Values: []string{"Bill", "2019-03-24", "id"}},
+			where:    "((name > CAST(:seek_0 AS text)) OR (name = CAST(:seek_0 AS text) AND date_created < CAST(:seek_1 AS timestamptz)) OR (name = CAST(:seek_0 AS text) AND date_created = CAST(:seek_1 AS timestamptz) AND user_id < CAST(:seek_2 AS uuid)))",
+			orderSQL: " ORDER BY name ASC, date_created DESC, user_id DESC",
+		},
+		{
+			name:     "mixed backward",
+			orderBy:  []order.By{order.NewBy("name", order.ASC), order.NewBy("dateCreated", order.DESC)},
+			seek:     order.Seek{Values: []string{"Bill", "2019-03-24", "id"}, Backward: true},
+			where:    "((name < CAST(:seek_0 AS text)) OR (name = CAST(:seek_0 AS text) AND date_created > CAST(:seek_1 AS timestamptz)) OR (name = CAST(:seek_0 AS text) AND date_created = CAST(:seek_1 AS timestamptz) AND user_id > CAST(:seek_2 AS uuid)))",
+			orderSQL: " ORDER BY name DESC, date_created ASC, user_id ASC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]any{}
+
+			where, err := keyset.Where(tt.orderBy, tt.seek, data)
+			if err != nil {
+				t.Fatalf("Should be able to compile the seek: %s", err)
+			}
+
+			if where != tt.where {
+				t.Errorf("Should get the condition %q, got %q.", tt.where, where)
+			}
+
+			for i, value := range tt.seek.Values {
+				if got := data[fmt.Sprintf("seek_%d", i)]; got != value {
+					t.Errorf("Should pass the value %q for seek_%d, got %v.", value, i, got)
+				}
+			}
+
+			orderSQL, err := keyset.OrderBy(tt.orderBy, tt.seek)
+			if err != nil {
+				t.Fatalf("Should be able to compile the order: %s", err)
+			}
+
+			if orderSQL != tt.orderSQL {
+				t.Errorf("Should get the order %q, got %q.", tt.orderSQL, orderSQL)
+			}
+		})
+	}
+}
+
+// TestKeysetWhereFail checks seeks that don't match the fields are rejected.
+func TestKeysetWhereFail(t *testing.T) {
+	tests := []struct {
+		name    string
+		orderBy []order.By
+		seek    order.Seek
+	}{
+		{
+			name:    "missing key",
+			orderBy: []order.By{order.NewBy("name", order.ASC)},
+			seek:    order.Seek{Values: []string{"Bill"}},
+		},
+		{
+			name:    "extra value",
+			orderBy: []order.By{order.NewBy("name", order.ASC)},
+			seek:    order.Seek{Values: []string{"Bill", "id", "x"}},
+		},
+		{
+			name:    "unknown field",
+			orderBy: []order.By{order.NewBy("password_hash", order.ASC)},
+			seek:    order.Seek{Values: []string{"x", "id"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if where, err := keyset.Where(tt.orderBy, tt.seek, map[string]any{}); err == nil {
+				t.Errorf("Should fail to compile the seek, got %q.", where)
+			}
+		})
+	}
+}
+
+// TestSeekCheck checks seeks read from a client are checked against the
+// fields before they reach the database.
+func TestSeekCheck(t *testing.T) {
+	orderBy := []order.By{order.NewBy("name", order.ASC)}
+
+	parse := func(field string, value string) error {
+		if field == "userID" && value != "id" {
+			return errors.New("not a uuid")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name   string
+		values []string
+		fail   bool
+	}{
+		{name: "valid", values: []string{"Bill", "id"}},
+		{name: "missing key", values: []string{"Bill"}, fail: true},
+		{name: "bad key", values: []string{"Bill", "1 OR 1=1"}, fail: true},
+		{name: "not utf8", values: []string{"\xff", "id"}, fail: true},
+		{name: "nul", values: []string{"Bi\x00ll", "id"}, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := order.Seek{Values: tt.values}.Check(orderBy, keyset.Key, parse)
+			if tt.fail != (err != nil) {
+				t.Errorf("Should fail %t, got %v.", tt.fail, err)
+			}
+		})
+	}
+}
+
+// TestNewSeek checks a seek holds the values of the fields and the key.
+func TestNewSeek(t *testing.T) {
+	row := map[string]string{"name": "Bill", "userID": "id"}
+
+	seek := order.NewSeek([]order.By{order.NewBy("name", order.DESC)}, keyset.Key, func(field string) string {
+		return row[field]
+	})
+
+	want := []string{"Bill", "id"}
+	if !reflect.DeepEqual(seek.Values, want) {
+		t.Errorf("Should get the values %q, got %q.", want, seek.Values)
+	}
+}
@@ -16,6 +16,9 @@ const (
 	DESC = "DESC"
 )
 
+// MaxFields is the number of fields results can be ordered by at once.
+const MaxFields = 3
+
 var directions = map[string]string{
 	ASC:  "ASC",
 	DESC: "DESC",
@@ -39,30 +42,53 @@ func NewBy(field string, direction string) By {
 
 // =============================================================================
 
-// Parse constructs an order.By value by parsing a string in the form
-// of "field,direction".
-func Parse(r *http.Request, defaultOrder By) (By, error) {
+// Parse constructs a list of order.By values by parsing a string in the form
+// of "field,direction;field,direction". Results are ordered by the first
+// field, then by the next for rows that are equal, up to MaxFields fields.
+// The direction defaults to ASC.
+func Parse(r *http.Request, defaultOrder By) ([]By, error) {
 	v := r.URL.Query().Get("orderBy")
 
 	if v == "" {
-		return defaultOrder, nil
+		return []By{defaultOrder}, nil
 	}
 
-	orderParts := strings.Split(v, ",")
-
-	var by By
-	switch len(orderParts) {
-	case 1:
-		by = NewBy(strings.Trim(orderParts[0], " "), ASC)
-	case 2:
-		by = NewBy(strings.Trim(orderParts[0], " "), strings.Trim(orderParts[1], " "))
-	default:
-		return By{}, validate.NewFieldsError(v, errors.New("unknown order field"))
+	fields := strings.Split(v, ";")
+	if len(fields) > MaxFields {
+		return nil, validate.NewFieldsError(v, fmt.Errorf("at most %d order fields are allowed", MaxFields))
 	}
 
-	if _, exists := directions[by.Direction]; !exists {
-		return By{}, validate.NewFieldsError(v, fmt.Errorf("unknown direction: %s", by.Direction))
+	bys := make([]By, 0, len(fields))
+	seen := make(map[string]struct{}, len(fields))
+
+	for _, field := range fields {
+		orderParts := strings.Split(field, ",")
+
+		var by By
+		switch len(orderParts) {
+		case 1:
+			by = NewBy(strings.Trim(orderParts[0], " "), ASC)
+		case 2:
+			by = NewBy(strings.Trim(orderParts[0], " "), strings.Trim(orderParts[1], " "))
+		default:
+			return nil, validate.NewFieldsError(v, errors.New("unknown order field"))
+		}
+
+		if by.Field == "" {
+			return nil, validate.NewFieldsError(v, errors.New("empty order field"))
+		}
+
+		if _, exists := directions[by.Direction]; !exists {
+			return nil, validate.NewFieldsError(v, fmt.Errorf("unknown direction: %s", by.Direction))
+		}
+
+		if _, exists := seen[by.Field]; exists {
+			return nil, validate.NewFieldsError(v, fmt.Errorf("order field repeated: %s", by.Field))
+		}
+		seen[by.Field] = struct{}{}
+
+		bys = append(bys, by)
 	}
 
-	return by, nil
+	return bys, nil
 }
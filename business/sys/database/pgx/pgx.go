@@ -7,13 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
-	"github.com/ardanlabs/service/foundation/web"
 	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	"github.com/shawnzxx/service/foundation/web"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -160,10 +162,13 @@ func ExecContext(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext
 func NamedExecContext(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data any) error {
 	q := queryString(query, data)
 
+	ctx, span := web.AddSpan(ctx, "business.sys.database.exec", attribute.String("query", query))
+	defer span.End()
+
 	if _, ok := data.(struct{}); ok {
-		log.WithOptions(zap.AddCallerSkip(3)).Infow("database.NamedExecContext", "trace_id", web.GetTraceID(ctx), "query", q)
+		log.WithOptions(zap.AddCallerSkip(3)).Debugw("database.NamedExecContext", "trace_id", web.GetTraceID(ctx), "query", q)
 	} else {
-		log.WithOptions(zap.AddCallerSkip(2)).Infow("database.NamedExecContext", "trace_id", web.GetTraceID(ctx), "query", q)
+		log.WithOptions(zap.AddCallerSkip(2)).Debugw("database.NamedExecContext", "trace_id", web.GetTraceID(ctx), "query", q)
 	}
 
 	if _, err := sqlx.NamedExecContext(ctx, db, query, data); err != nil {
@@ -204,7 +209,10 @@ func NamedQuerySliceUsingIn[T any](ctx context.Context, log *zap.SugaredLogger,
 func namedQuerySlice[T any](ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data any, dest *[]T, withIn bool) error {
 	q := queryString(query, data)
 
-	log.WithOptions(zap.AddCallerSkip(3)).Infow("database.NamedQuerySlice", "trace_id", web.GetTraceID(ctx), "query", q)
+	log.WithOptions(zap.AddCallerSkip(3)).Debugw("database.NamedQuerySlice", "trace_id", web.GetTraceID(ctx), "query", q)
+
+	ctx, span := web.AddSpan(ctx, "business.sys.database.queryslice", attribute.String("query", query))
+	defer span.End()
 
 	var rows *sqlx.Rows
 	var err error
@@ -251,6 +259,41 @@ func namedQuerySlice[T any](ctx context.Context, log *zap.SugaredLogger, db sqlx
 	return nil
 }
 
+// NamedQueryStream is a helper function for executing queries that return a
+// collection of data where each row is passed to the function as it's read
+// from the database cursor, instead of holding the whole result in memory.
+// Iteration stops at the first error returned by the function.
+func NamedQueryStream[T any](ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data any, fn func(T) error) error {
+	q := queryString(query, data)
+
+	log.WithOptions(zap.AddCallerSkip(2)).Debugw("database.NamedQueryStream", "trace_id", web.GetTraceID(ctx), "query", q)
+
+	ctx, span := web.AddSpan(ctx, "business.sys.database.querystream", attribute.String("query", query))
+	defer span.End()
+
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
+	if err != nil {
+		if pqerr, ok := err.(*pgconn.PgError); ok && pqerr.Code == undefinedTable {
+			return ErrUndefinedTable
+		}
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v T
+		if err := rows.StructScan(&v); err != nil {
+			return err
+		}
+
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // QueryStruct is a helper function for executing queries that return a
 // single value to be unmarshalled into a struct type where field replacement is necessary.
 func QueryStruct(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, dest any) error {
@@ -273,7 +316,10 @@ func NamedQueryStructUsingIn(ctx context.Context, log *zap.SugaredLogger, db sql
 func namedQueryStruct(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data any, dest any, withIn bool) error {
 	q := queryString(query, data)
 
-	log.WithOptions(zap.AddCallerSkip(3)).Infow("database.NamedQueryStruct", "trace_id", web.GetTraceID(ctx), "query", q)
+	log.WithOptions(zap.AddCallerSkip(3)).Debugw("database.NamedQueryStruct", "trace_id", web.GetTraceID(ctx), "query", q)
+
+	ctx, span := web.AddSpan(ctx, "business.sys.database.querystruct", attribute.String("query", query))
+	defer span.End()
 
 	var rows *sqlx.Rows
 	var err error
@@ -300,14 +346,14 @@ func namedQueryStruct(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtCo
 	}
 
 	if err != nil {
-		if pqerr, ok := err.(*pgconn.PgError); ok && pqerr.Code == undefinedTable {
-			return ErrUndefinedTable
-		}
-		return err
+		return queryError(err)
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return queryError(err)
+		}
 		return ErrDBNotFound
 	}
 
@@ -318,14 +364,50 @@ func namedQueryStruct(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtCo
 	return nil
 }
 
+// queryError translates the postgres errors callers need to act on. The
+// driver reports errors from statements like UPDATE ... RETURNING when the
+// rows are read rather than when the query is sent.
+func queryError(err error) error {
+	var pqerr *pgconn.PgError
+	if errors.As(err, &pqerr) {
+		switch pqerr.Code {
+		case undefinedTable:
+			return ErrUndefinedTable
+		case uniqueViolation:
+			return ErrDBDuplicatedEntry
+		}
+	}
+	return err
+}
+
+// secretParams names the parameters whose values are kept out of the logs,
+// since they hold credentials or what's needed to derive them.
+var secretParams = map[string]bool{
+	"password_hash":      true,
+	"mfa_secret":         true,
+	"mfa_recovery_codes": true,
+}
+
+// paramName matches the named parameters of a query, skipping the "::" of
+// a type cast.
+var paramName = regexp.MustCompile(`(?:^|[^:]):([A-Za-z_][A-Za-z0-9_.]*)`)
+
 // queryString provides a pretty print version of the query and parameters.
+// It holds the values of the parameters, so it's only logged at debug level
+// and never added to spans, and the values of secret parameters are
+// replaced.
 func queryString(query string, args any) string {
+	var names []string
+	for _, match := range paramName.FindAllStringSubmatch(query, -1) {
+		names = append(names, match[1])
+	}
+
 	query, params, err := sqlx.Named(query, args)
 	if err != nil {
 		return err.Error()
 	}
 
-	for _, param := range params {
+	for i, param := range params {
 		var value string
 		switch v := param.(type) {
 		case string:
@@ -335,6 +417,13 @@ func queryString(query string, args any) string {
 		default:
 			value = fmt.Sprintf("%v", v)
 		}
+
+		// When the parameters can't be matched to their names, none of the
+		// values are logged.
+		if len(names) != len(params) || secretParams[names[i]] {
+			value = "'[REDACTED]'"
+		}
+
 		query = strings.Replace(query, "?", value, 1)
 	}
 
@@ -0,0 +1,144 @@
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idPrefix identifies hashes encoded by the Argon2id algorithm.
+const argon2idPrefix = "$argon2id$"
+
+// Argon2idParams represents the cost parameters for the Argon2id algorithm.
+type Argon2idParams struct {
+	Memory      uint32 // Memory in KiB.
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the second recommended option in RFC 9106.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2id hashes passwords with the Argon2id algorithm. Hashes are encoded in
+// the PHC string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type Argon2id struct {
+	params Argon2idParams
+}
+
+// NewArgon2id constructs an Argon2id algorithm with the specified parameters.
+func NewArgon2id(params Argon2idParams) (*Argon2id, error) {
+	switch {
+	case params.Iterations < 1:
+		return nil, fmt.Errorf("argon2id: iterations must be at least 1")
+	case params.Parallelism < 1:
+		return nil, fmt.Errorf("argon2id: parallelism must be at least 1")
+	case params.Memory < 8*uint32(params.Parallelism):
+		return nil, fmt.Errorf("argon2id: memory must be at least 8*parallelism KiB")
+	case params.SaltLength < 8:
+		return nil, fmt.Errorf("argon2id: salt length must be at least 8 bytes")
+	case params.KeyLength < 16:
+		return nil, fmt.Errorf("argon2id: key length must be at least 16 bytes")
+	}
+
+	return &Argon2id{
+		params: params,
+	}, nil
+}
+
+// Hash implements the Algorithm interface.
+func (a *Argon2id) Hash(password string) ([]byte, error) {
+	salt := make([]byte, a.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.params.Iterations, a.params.Memory, a.params.Parallelism, a.params.KeyLength)
+
+	return []byte(encodeArgon2id(a.params, salt, key)), nil
+}
+
+// Verify implements the Algorithm interface.
+func (a *Argon2id) Verify(hash []byte, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+// Identify implements the Algorithm interface.
+func (a *Argon2id) Identify(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(argon2idPrefix))
+}
+
+// Current implements the Algorithm interface.
+func (a *Argon2id) Current(hash []byte) bool {
+	params, _, _, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	return params == a.params
+}
+
+// =============================================================================
+
+var b64 = base64.RawStdEncoding
+
+func encodeArgon2id(params Argon2idParams, salt []byte, key []byte) string {
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, params.Memory, params.Iterations, params.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key))
+}
+
+func decodeArgon2id(hash []byte) (Argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, ErrUnknownAlgorithm
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("argon2id: parsing version: %w", err)
+	}
+	if version != argon2.Version {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("argon2id: unsupported version %d", version)
+	}
+
+	var params Argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("argon2id: parsing parameters: %w", err)
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("argon2id: decoding salt: %w", err)
+	}
+
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("argon2id: decoding key: %w", err)
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,57 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes passwords with the bcrypt algorithm. Bcrypt only uses the
+// first 72 bytes of a password and longer passwords are rejected, so it is
+// kept for verifying existing hashes. Verifying reads the cost from the
+// hash, so the cost only applies when hashing.
+type Bcrypt struct {
+	cost int
+}
+
+// NewBcrypt constructs a Bcrypt algorithm that hashes with the default cost.
+func NewBcrypt() *Bcrypt {
+	return &Bcrypt{
+		cost: bcrypt.DefaultCost,
+	}
+}
+
+// Hash implements the Algorithm interface.
+func (b *Bcrypt) Hash(password string) ([]byte, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+	if err != nil {
+		return nil, fmt.Errorf("generatefrompassword: %w", err)
+	}
+
+	return hash, nil
+}
+
+// Verify implements the Algorithm interface.
+func (b *Bcrypt) Verify(hash []byte, password string) error {
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatch
+		}
+		return fmt.Errorf("comparehashandpassword: %w", err)
+	}
+
+	return nil
+}
+
+// Identify implements the Algorithm interface.
+func (b *Bcrypt) Identify(hash []byte) bool {
+	_, err := bcrypt.Cost(hash)
+	return err == nil
+}
+
+// Current implements the Algorithm interface.
+func (b *Bcrypt) Current(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err == nil && cost == b.cost
+}
@@ -0,0 +1,85 @@
+// Package password provides support for hashing and verifying passwords. Every
+// hash records the algorithm and the parameters used to produce it, so hashes
+// made with older algorithms or weaker parameters can be identified and
+// upgraded over time.
+package password
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Set of error variables for password operations.
+var (
+	ErrMismatch         = errors.New("password does not match hash")
+	ErrUnknownAlgorithm = errors.New("hash algorithm is not supported")
+)
+
+// Algorithm declares the behavior a password hashing algorithm must provide.
+type Algorithm interface {
+
+	// Hash returns the encoded hash of the password, including the
+	// algorithm identifier and the parameters used.
+	Hash(password string) ([]byte, error)
+
+	// Verify compares the password against an encoded hash produced by
+	// this algorithm. It returns ErrMismatch when they do not match.
+	Verify(hash []byte, password string) error
+
+	// Identify reports whether the encoded hash was produced by this
+	// algorithm.
+	Identify(hash []byte) bool
+
+	// Current reports whether the encoded hash was produced with the
+	// parameters this algorithm is configured with.
+	Current(hash []byte) bool
+}
+
+// Hasher hashes new passwords with its primary algorithm and can verify hashes
+// produced by any of its algorithms.
+type Hasher struct {
+	primary Algorithm
+	legacy  []Algorithm
+}
+
+// New constructs a Hasher that hashes with the primary algorithm and still
+// accepts hashes made by the legacy algorithms.
+func New(primary Algorithm, legacy ...Algorithm) *Hasher {
+	return &Hasher{
+		primary: primary,
+		legacy:  legacy,
+	}
+}
+
+// Hash returns the encoded hash of the password using the primary algorithm.
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	hash, err := h.primary.Hash(password)
+	if err != nil {
+		return nil, fmt.Errorf("hash: %w", err)
+	}
+
+	return hash, nil
+}
+
+// Verify compares the password against the encoded hash. On success it
+// reports whether the hash should be replaced because it was not produced by
+// the primary algorithm with its current parameters.
+func (h *Hasher) Verify(hash []byte, password string) (rehash bool, err error) {
+	if h.primary.Identify(hash) {
+		if err := h.primary.Verify(hash, password); err != nil {
+			return false, err
+		}
+		return !h.primary.Current(hash), nil
+	}
+
+	for _, alg := range h.legacy {
+		if alg.Identify(hash) {
+			if err := alg.Verify(hash, password); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+
+	return false, ErrUnknownAlgorithm
+}
@@ -9,20 +9,57 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/shawnzxx/service/business/core/user"
+	"github.com/shawnzxx/service/business/web/metrics"
+	"github.com/shawnzxx/service/foundation/web"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
-// ErrForbidden is returned when a auth issue is identified.
-var ErrForbidden = errors.New("attempted action is not allowed")
+// Set of error variables for auth operations.
+var (
+	ErrForbidden     = errors.New("attempted action is not allowed")
+	ErrImpersonating = errors.New("attempted action is not allowed while impersonating")
+	ErrImpersonation = errors.New("user can't be impersonated")
+	ErrMFAPending    = errors.New("multi-factor authentication has not been completed")
+)
+
+// Set of authentication methods recorded in the "amr" claim, as registered
+// in RFC 8176.
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+	AMRMFA      = "mfa"
+)
 
-// Claims represents the authorization claims transmitted via a JWT.
+// Claims represents the authorization claims transmitted via a JWT. Client
+// is set from the client certificate of the connection and is never part of
+// a token. CertOnly is set when the caller authenticated with its client
+// certificate alone, without a token.
 type Claims struct {
 	jwt.RegisteredClaims
-	Roles []user.Role `json:"roles"`
+	Roles      []user.Role `json:"roles"`
+	Actor      *Actor      `json:"act,omitempty"`
+	AMR        []string    `json:"amr,omitempty"`
+	MFAPending bool        `json:"mfa_pending,omitempty"`
+	Client     *Client     `json:"-"`
+	CertOnly   bool        `json:"-"`
+}
+
+// Impersonated reports whether the token was issued to an actor acting on
+// behalf of the subject.
+func (c Claims) Impersonated() bool {
+	return c.Actor != nil
+}
+
+// Actor identifies the party acting on behalf of the subject of a token. It
+// follows the "act" claim defined in RFC 8693.
+type Actor struct {
+	Subject string `json:"sub"`
 }
 
 // KeyLookup declares a method set of behavior for looking up private and public keys for JWT use.
@@ -33,11 +70,16 @@ type KeyLookup interface {
 	PublicKey(kid string) (key string, err error)
 }
 
-// Config represents information required to initialize auth.
+// Config represents information required to initialize auth. ClientRoles
+// grants roles to the identities of client certificates, for callers that
+// authenticate with a certificate only.
 type Config struct {
-	Log       *zap.SugaredLogger
-	KeyLookup KeyLookup
-	Issuer    string
+	Log         *zap.SugaredLogger
+	KeyLookup   KeyLookup
+	Issuer      string
+	ActiveKID   string
+	MFARequired bool
+	ClientRoles map[string][]user.Role
 }
 
 // Auth is used to authenticate clients. It can generate a token for a
@@ -48,8 +90,12 @@ type Auth struct {
 	method    jwt.SigningMethod
 	parser    *jwt.Parser
 	issuer    string
+	activeKID string
+	mfaReq    bool
+	clients   map[string][]user.Role
 	mu        sync.RWMutex
 	cache     map[string]string
+	queries   map[string]rego.PreparedEvalQuery
 }
 
 // New creates an Auth to support authentication/authorization.
@@ -60,14 +106,23 @@ func New(cfg Config) (*Auth, error) {
 		method:    jwt.GetSigningMethod(jwt.SigningMethodRS256.Name),                          // generate token with private key using RS256 algorithm
 		parser:    jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Name})), // parser back claim obj from JWT
 		issuer:    cfg.Issuer,
+		activeKID: cfg.ActiveKID,
+		mfaReq:    cfg.MFARequired,
+		clients:   cfg.ClientRoles,
 		cache:     make(map[string]string),
+		queries:   make(map[string]rego.PreparedEvalQuery),
 	}
 
 	return &a, nil
 }
 
 // GenerateToken generates a signed JWT token string representing the user Claims.
+// The configured issuer is used when the claims do not provide one.
 func (a *Auth) GenerateToken(kid string, claims Claims) (string, error) {
+	if claims.Issuer == "" {
+		claims.Issuer = a.issuer
+	}
+
 	// if you want to generate token, you give kid you give claims
 	token := jwt.NewWithClaims(a.method, claims)
 	// put kid in to the token
@@ -93,8 +148,70 @@ func (a *Auth) GenerateToken(kid string, claims Claims) (string, error) {
 	return str, nil
 }
 
-// Authenticate processes to validate the token's signature.
+// Authenticate processes to validate the token's signature. Tokens that are
+// still waiting for the second authentication step are rejected.
 func (a *Auth) Authenticate(ctx context.Context, bearerToken string) (Claims, error) {
+	claims, err := a.verify(ctx, bearerToken)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if claims.MFAPending {
+		return Claims{}, ErrMFAPending
+	}
+
+	// TODO additional check for authentication
+	//  check our the database for this user still enabled.
+
+	// Every request made with an impersonation token leaves an audit record
+	// naming both the admin and the user being impersonated.
+	if claims.Impersonated() {
+		a.log.Infow("audit", "trace_id", web.GetTraceID(ctx), "action", "impersonated request", "subject", claims.Subject, "actor", claims.Actor.Subject)
+	}
+
+	return claims, nil
+}
+
+// AuthenticateClient constructs the claims of a caller that authenticated
+// with a verified client certificate only. The subject is the identity of
+// the client, and the roles are the ones granted to it in the config.
+func (a *Auth) AuthenticateClient(ctx context.Context, client Client) (Claims, error) {
+	roles, exists := a.clients[client.Identity]
+	if !exists {
+		return Claims{}, fmt.Errorf("%w: %s", errUnknownClient, client.Identity)
+	}
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: client.Identity,
+		},
+		Roles:    roles,
+		Client:   &client,
+		CertOnly: true,
+	}
+
+	a.log.Infow("audit", "trace_id", web.GetTraceID(ctx), "action", "client certificate request", "subject", client.Identity, "serial", client.Serial)
+
+	return claims, nil
+}
+
+// AuthenticateChallenge validates a token issued by Challenge. Only tokens
+// waiting for the second authentication step are accepted.
+func (a *Auth) AuthenticateChallenge(ctx context.Context, bearerToken string) (Claims, error) {
+	claims, err := a.verify(ctx, bearerToken)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if !claims.MFAPending {
+		return Claims{}, errors.New("token is not a multi-factor challenge")
+	}
+
+	return claims, nil
+}
+
+// verify validates the token's signature and returns its claims.
+func (a *Auth) verify(ctx context.Context, bearerToken string) (Claims, error) {
 	parts := strings.Split(bearerToken, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
 		return Claims{}, errors.New("expected authorization header format: Bearer <token>")
@@ -136,20 +253,27 @@ func (a *Auth) Authenticate(ctx context.Context, bearerToken string) (Claims, er
 		return Claims{}, fmt.Errorf("authentication failed : %w", err)
 	}
 
-	// TODO additional check for authentication
-	//  check our the database for this user still enabled.
-	
 	return claims, nil
 }
 
 // Authorize attempts to authorize the user with the provided input roles, if
 // none of the input roles are within the user's claims, we return an error
-// otherwise the user is authorized.
-func (a *Auth) Authorize(ctx context.Context, claims Claims, rule string) error {
+// otherwise the user is authorized. The userID is the owner of the resource
+// being accessed, when the rule needs one.
+func (a *Auth) Authorize(ctx context.Context, claims Claims, userID string, rule string) error {
+	if userID == "" {
+		userID = claims.Subject
+	}
+
 	input := map[string]any{
-		"Roles":   claims.Roles,
-		"Subject": claims.Subject,
-		"UserID":  claims.Subject,
+		"Roles":        claims.Roles,
+		"Subject":      claims.Subject,
+		"UserID":       userID,
+		"Impersonated": claims.Impersonated(),
+		"AMR":          claims.AMR,
+		"MFARequired":  a.mfaReq,
+		"Client":       claims.Client,
+		"CertOnly":     claims.CertOnly,
 	}
 
 	if err := a.opaPolicyEvaluation(ctx, opaAuthorization, rule, input); err != nil {
@@ -159,8 +283,127 @@ func (a *Auth) Authorize(ctx context.Context, claims Claims, rule string) error
 	return nil
 }
 
+// Redactions evaluates the specified redaction rule for a record owned by
+// ownerID and returns the fields that must be removed or masked before the
+// record is shown to the owner of the claims.
+func (a *Auth) Redactions(ctx context.Context, claims Claims, ownerID string, rule string) (Redactions, error) {
+	input := map[string]any{
+		"Roles":        claims.Roles,
+		"Subject":      claims.Subject,
+		"OwnerID":      ownerID,
+		"Impersonated": claims.Impersonated(),
+		"Client":       claims.Client,
+	}
+
+	results, err := a.opaEval(ctx, opaRedaction, rule, input)
+	if err != nil {
+		return nil, fmt.Errorf("rego evaluation failed : %w", err)
+	}
+
+	fields, ok := results[0].Bindings["x"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("bindings results[%v] ok[%v]", results, ok)
+	}
+
+	redactions := make(Redactions, len(fields))
+	for field, action := range fields {
+		act, ok := action.(string)
+		if !ok {
+			return nil, fmt.Errorf("field %q has an invalid action %v", field, action)
+		}
+		redactions[field] = act
+	}
+
+	return redactions, nil
+}
+
+// Token generates a token for the user that expires after the specified
+// duration. The amr lists the methods used to authenticate the user.
+func (a *Auth) Token(usr user.User, amr []string, ttl time.Duration) (string, error) {
+	claims := a.claims(usr, ttl)
+	claims.AMR = amr
+
+	token, err := a.GenerateToken(a.activeKID, claims)
+	if err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+
+	return token, nil
+}
+
+// Challenge generates a token for a user who passed the first authentication
+// step and still has to provide a second factor. It can only be exchanged for
+// a full token and is rejected by Authenticate.
+func (a *Auth) Challenge(usr user.User, amr []string, ttl time.Duration) (string, error) {
+	claims := a.claims(usr, ttl)
+	claims.AMR = amr
+	claims.MFAPending = true
+
+	token, err := a.GenerateToken(a.activeKID, claims)
+	if err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+
+	return token, nil
+}
+
+// ActiveKID returns the key id used to sign tokens issued by the service.
+func (a *Auth) ActiveKID() string {
+	return a.activeKID
+}
+
+// Impersonate generates a token for the specified user on behalf of the actor
+// found in the claims. The token carries the actor in the "act" claim and
+// expires after the specified duration. Admins and the actor themselves
+// can't be impersonated, since the token would carry the admin role under
+// an identity that isn't the actor's.
+func (a *Auth) Impersonate(actor Claims, usr user.User, ttl time.Duration) (string, error) {
+	if actor.Impersonated() {
+		return "", ErrImpersonating
+	}
+
+	if usr.ID.String() == actor.Subject {
+		return "", fmt.Errorf("%w: user is the actor", ErrImpersonation)
+	}
+
+	for _, role := range usr.Roles {
+		if role == user.RoleAdmin {
+			return "", fmt.Errorf("%w: user is an admin", ErrImpersonation)
+		}
+	}
+
+	claims := a.claims(usr, ttl)
+	claims.Actor = &Actor{
+		Subject: actor.Subject,
+	}
+
+	token, err := a.GenerateToken(a.activeKID, claims)
+	if err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+
+	a.log.Infow("audit", "action", "impersonation token issued", "subject", claims.Subject, "actor", actor.Subject, "expires", claims.ExpiresAt.Time)
+
+	return token, nil
+}
+
 // =============================================================================
 
+// claims constructs the claims for a token issued to the user.
+func (a *Auth) claims(usr user.User, ttl time.Duration) Claims {
+	now := time.Now().UTC()
+
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   usr.ID.String(),
+			Issuer:    a.issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Roles: usr.Roles,
+	}
+}
+
 // publicKeyLookup performs a lookup for the public pem for the specified kid.
 func (a *Auth) publicKeyLookup(kid string) (string, error) {
 	pem, err := func() (string, error) {
@@ -192,29 +435,69 @@ func (a *Auth) publicKeyLookup(kid string) (string, error) {
 // opaPolicyEvaluation asks opa to evaulate the token against the specified token
 // policy and public key.
 func (a *Auth) opaPolicyEvaluation(ctx context.Context, opaPolicy string, rule string, input any) error {
-	query := fmt.Sprintf("x = data.%s.%s", opaPackage, rule)
-
-	q, err := rego.New(
-		rego.Query(query),
-		rego.Module("policy.rego", opaPolicy),
-	).PrepareForEval(ctx)
+	results, err := a.opaEval(ctx, opaPolicy, rule, input)
 	if err != nil {
 		return err
 	}
 
+	result, ok := results[0].Bindings["x"].(bool)
+	if !ok || !result {
+		return fmt.Errorf("bindings results[%v] ok[%v]", results, ok)
+	}
+
+	return nil
+}
+
+// opaEval runs the specified rule against the input and returns the results.
+// Prepared queries are cached so a policy is only compiled once per rule.
+func (a *Auth) opaEval(ctx context.Context, opaPolicy string, rule string, input any) (rego.ResultSet, error) {
+	ctx, span := web.AddSpan(ctx, "business.web.auth.opaeval", attribute.String("rule", rule))
+	defer span.End()
+
+	q, err := a.opaPrepare(ctx, opaPolicy, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
 	results, err := q.Eval(ctx, rego.EvalInput(input))
+	metrics.ObserveOPA(rule, time.Since(start), err)
+
 	if err != nil {
-		return fmt.Errorf("query: %w", err)
+		return nil, fmt.Errorf("query: %w", err)
 	}
 
 	if len(results) == 0 {
-		return errors.New("no results")
+		return nil, errors.New("no results")
 	}
 
-	result, ok := results[0].Bindings["x"].(bool)
-	if !ok || !result {
-		return fmt.Errorf("bindings results[%v] ok[%v]", results, ok)
+	return results, nil
+}
+
+// opaPrepare returns the prepared query for the rule, compiling the policy on
+// first use.
+func (a *Auth) opaPrepare(ctx context.Context, opaPolicy string, rule string) (rego.PreparedEvalQuery, error) {
+	query := fmt.Sprintf("x = data.%s.%s", opaPackage, rule)
+
+	a.mu.RLock()
+	q, exists := a.queries[query]
+	a.mu.RUnlock()
+
+	if exists {
+		return q, nil
 	}
 
-	return nil
+	q, err := rego.New(
+		rego.Query(query),
+		rego.Module("policy.rego", opaPolicy),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return rego.PreparedEvalQuery{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queries[query] = q
+
+	return q, nil
 }
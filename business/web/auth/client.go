@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shawnzxx/service/business/core/user"
+)
+
+// errUnknownClient is returned when a client certificate is the only
+// credential and its identity hasn't been granted any roles.
+var errUnknownClient = errors.New("client identity has no roles")
+
+// Client is the identity of a caller taken from the client certificate it
+// presented, after the certificate was verified against the client CAs.
+type Client struct {
+	Identity   string   `json:"identity"`
+	CommonName string   `json:"commonName"`
+	DNSNames   []string `json:"dnsNames,omitempty"`
+	URIs       []string `json:"uris,omitempty"`
+	Serial     string   `json:"serial"`
+}
+
+// NewClient constructs the identity of the caller from its verified client
+// certificate. The identity is the first URI SAN, like a SPIFFE ID, or the
+// common name when the certificate has none.
+func NewClient(cert *x509.Certificate) Client {
+	uris := make([]string, len(cert.URIs))
+	for i, uri := range cert.URIs {
+		uris[i] = uri.String()
+	}
+
+	identity := cert.Subject.CommonName
+	if len(uris) > 0 {
+		identity = uris[0]
+	}
+
+	return Client{
+		Identity:   identity,
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+		URIs:       uris,
+		Serial:     cert.SerialNumber.String(),
+	}
+}
+
+// ParseClientRoles parses the roles granted to client identities, given in
+// the form "identity=ROLE|ROLE".
+func ParseClientRoles(entries []string) (map[string][]user.Role, error) {
+	roles := make(map[string][]user.Role, len(entries))
+	for _, entry := range entries {
+		identity, names, found := strings.Cut(entry, "=")
+		if !found || identity == "" || names == "" {
+			return nil, fmt.Errorf("client roles %q: expected the form identity=ROLE|ROLE", entry)
+		}
+
+		for _, name := range strings.Split(names, "|") {
+			role, err := user.ParseRole(strings.TrimSpace(name))
+			if err != nil {
+				return nil, fmt.Errorf("client roles %q: %w", entry, err)
+			}
+			roles[identity] = append(roles[identity], role)
+		}
+	}
+
+	return roles, nil
+}
@@ -2,6 +2,9 @@ package auth
 
 import (
 	"context"
+	"fmt"
+
+	"github.com/google/uuid"
 )
 
 // ctxKey represents the type of value for the context key.
@@ -25,3 +28,12 @@ func GetClaims(ctx context.Context) Claims {
 	}
 	return v
 }
+
+// GetUserID returns the id of the user the claims in the context were issued to.
+func GetUserID(ctx context.Context) (uuid.UUID, error) {
+	userID, err := uuid.Parse(GetClaims(ctx).Subject)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("parsing subject: %w", err)
+	}
+	return userID, nil
+}
@@ -8,20 +8,26 @@ import (
 // AuthError is used to pass an error during the request through the
 // application with auth specific context.
 type AuthError struct {
-	msg string
+	err error
 }
 
-// NewAuthError creates an AuthError for the provided message.
+// NewAuthError creates an AuthError for the provided message. The message
+// can wrap an error with %w, like ErrForbidden, to tell the kind of failure.
 func NewAuthError(format string, args ...any) error {
 	return &AuthError{
-		msg: fmt.Sprintf(format, args...),
+		err: fmt.Errorf(format, args...),
 	}
 }
 
 // Error implements the error interface. It uses the default message of the
 // wrapped error. This is what will be shown in the services' logs.
 func (ae *AuthError) Error() string {
-	return ae.msg
+	return ae.err.Error()
+}
+
+// Unwrap returns the error wrapped by the message, if any.
+func (ae *AuthError) Unwrap() error {
+	return errors.Unwrap(ae.err)
 }
 
 // IsAuthError checks if an error of type AuthError exists.
@@ -0,0 +1,11 @@
+package auth
+
+// Set of actions a redaction rule can apply to a field.
+const (
+	RedactRemove = "remove"
+	RedactMask   = "mask"
+)
+
+// Redactions maps the json name of a field to the redaction action that must
+// be applied to it.
+type Redactions map[string]string
@@ -21,10 +21,15 @@ ruleAny {
 }
 
 # becuase we are comparing set, need to use {roleAdmin} with {}
+# An impersonation token never grants admin rights, even when the user's
+# roles would: the actions would be recorded against the user rather than
+# the admin acting as them.
 ruleAdminOnly {
 	claim_roles := {role | role := input.Roles[_]}
 	input_admin := {roleAdmin} & claim_roles
 	count(input_admin) > 0
+	mfa_satisfied
+	not input.Impersonated
 }
 
 # sample input to evaluate ruleAdminOnly:
@@ -43,9 +48,32 @@ ruleAdminOrSubject {
 	claim_roles := {role | role := input.Roles[_]}
 	input_admin := {roleAdmin} & claim_roles
     count(input_admin) > 0
+	mfa_satisfied
+	not input.Impersonated
 } else {
     claim_roles := {role | role := input.Roles[_]}
 	input_user := {roleUser} & claim_roles
 	count(input_user) > 0
 	input.UserID == input.Subject
 }
+
+# When input.MFARequired is set, admin access is only granted to tokens whose
+# amr claim shows a second factor was used: "otp" for an authenticator code
+# and "mfa" for a recovery code.
+mfa_satisfied {
+	not input.MFARequired
+}
+
+mfa_satisfied {
+	mfa_methods := {"otp", "mfa"}
+	claim_amr := {method | method := input.AMR[_]}
+	count(mfa_methods & claim_amr) > 0
+}
+
+# A caller authenticated by its client certificate alone is a service rather
+# than a person, so there is no second factor to ask for. input.CertOnly is
+# only set when no token was presented, so a token whose subject happens to
+# match the identity of a certificate still needs the second factor.
+mfa_satisfied {
+	input.CertOnly == true
+}
@@ -0,0 +1,25 @@
+package shawn.rego
+
+roleAdmin := "ADMIN"
+
+# Each redaction rule produces an object that maps the json name of a field
+# to the action that must be applied to it before the record is returned:
+# "remove" drops the field, "mask" hides most of its value.
+default redactUser = {}
+
+# sample input to evaluate redactUser:
+# {
+#     "Subject": "12345",
+#     "OwnerID": "67890",
+#     "Roles": ["USER"]
+# }
+redactUser = {"email": "mask", "department": "remove"} {
+	not is_admin
+	input.OwnerID != input.Subject
+}
+
+is_admin {
+	claim_roles := {role | role := input.Roles[_]}
+	input_admin := {roleAdmin} & claim_roles
+	count(input_admin) > 0
+}
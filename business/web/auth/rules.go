@@ -13,6 +13,11 @@ const (
 	RuleAdminOrSubject = "ruleAdminOrSubject"
 )
 
+// These the current set of rules we have for redacting response fields.
+const (
+	RuleRedactUser = "redactUser"
+)
+
 // Package name of our rego code.
 const (
 	opaPackage string = "shawn.rego"
@@ -25,4 +30,7 @@ var (
 
 	//go:embed rego/authorization.rego
 	opaAuthorization string
+
+	//go:embed rego/redaction.rego
+	opaRedaction string
 )
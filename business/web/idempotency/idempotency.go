@@ -0,0 +1,120 @@
+// Package idempotency provides support for safely retrying requests that
+// aren't idempotent by recording the response to the first request made
+// with an idempotency key and replaying it for the retries.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Set of errors returned by Begin when a request can't be processed.
+var (
+	ErrInFlight  = errors.New("a request with this idempotency key is already being processed")
+	ErrKeyReused = errors.New("idempotency key was already used for a different request")
+)
+
+// Response is the recorded response to a request.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Record is the state of an idempotency key. The response is nil while the
+// first request made with the key is still being processed.
+type Record struct {
+	Fingerprint string
+	Response    *Response
+	Expires     time.Time
+}
+
+// Store defines the behavior required to keep track of idempotency keys. An
+// implementation backed by a shared system allows replicas of the service
+// to recognize retries sent to another replica.
+type Store interface {
+
+	// Start atomically claims the key for a request with the fingerprint.
+	// When the key holds an unexpired record, that record is returned and
+	// the key isn't claimed.
+	Start(ctx context.Context, key string, fingerprint string, expires time.Time, now time.Time) (Record, bool, error)
+
+	// Complete stores the response for a claimed key.
+	Complete(ctx context.Context, key string, resp Response) error
+
+	// Release removes a claimed key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// =============================================================================
+
+// Config represents information required to construct a recorder.
+type Config struct {
+	Log   *zap.SugaredLogger
+	Store Store
+	TTL   time.Duration
+}
+
+// Recorder records the responses to requests made with idempotency keys.
+type Recorder struct {
+	log   *zap.SugaredLogger
+	store Store
+	ttl   time.Duration
+}
+
+// New constructs a recorder. Responses are replayed for retries made
+// within the TTL.
+func New(cfg Config) *Recorder {
+	return &Recorder{
+		log:   cfg.Log,
+		store: cfg.Store,
+		ttl:   cfg.TTL,
+	}
+}
+
+// Begin claims the key for a request with the fingerprint. It returns the
+// recorded response when the request is a retry of a completed request, and
+// nil when the request should be processed. If the store fails the request
+// is processed, since rejecting all traffic is worse than the chance of a
+// duplicate.
+func (rc *Recorder) Begin(ctx context.Context, key string, fingerprint string) (*Response, error) {
+	now := time.Now()
+
+	rec, started, err := rc.store.Start(ctx, key, fingerprint, now.Add(rc.ttl), now)
+	if err != nil {
+		rc.log.Errorw("idempotency", "ERROR", err, "key", key)
+		return nil, nil
+	}
+
+	switch {
+	case started:
+		return nil, nil
+
+	case rec.Fingerprint != fingerprint:
+		return nil, ErrKeyReused
+
+	case rec.Response == nil:
+		return nil, ErrInFlight
+	}
+
+	return rec.Response, nil
+}
+
+// Complete records the response for the key claimed by Begin.
+func (rc *Recorder) Complete(ctx context.Context, key string, resp Response) {
+	if err := rc.store.Complete(ctx, key, resp); err != nil {
+		rc.log.Errorw("idempotency", "ERROR", err, "key", key)
+	}
+}
+
+// Release gives up the key claimed by Begin without recording a response,
+// so a retry is processed again.
+func (rc *Recorder) Release(ctx context.Context, key string) {
+	if err := rc.store.Release(ctx, key); err != nil {
+		rc.log.Errorw("idempotency", "ERROR", err, "key", key)
+	}
+}
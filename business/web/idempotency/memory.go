@@ -0,0 +1,84 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired records are removed from memory.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps idempotency records in the memory of a single process.
+// It's suitable when only one instance of the service is running.
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[string]*Record
+	lastSweep time.Time
+}
+
+// NewMemoryStore constructs an empty in memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]*Record),
+	}
+}
+
+// Start claims the key unless it holds a record that hasn't expired.
+func (s *MemoryStore) Start(ctx context.Context, key string, fingerprint string, expires time.Time, now time.Time) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	if rec, exists := s.records[key]; exists && now.Before(rec.Expires) {
+		return *rec, false, nil
+	}
+
+	s.records[key] = &Record{
+		Fingerprint: fingerprint,
+		Expires:     expires,
+	}
+
+	return Record{}, true, nil
+}
+
+// Complete stores the response for the key.
+func (s *MemoryStore) Complete(ctx context.Context, key string, resp Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, exists := s.records[key]
+	if !exists {
+		return fmt.Errorf("key %q isn't claimed", key)
+	}
+
+	rec.Response = &resp
+
+	return nil
+}
+
+// Release removes the key.
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+// sweep removes records that have expired.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, rec := range s.records {
+		if !now.Before(rec.Expires) {
+			delete(s.records, key)
+		}
+	}
+}
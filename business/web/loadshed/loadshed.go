@@ -0,0 +1,139 @@
+// Package loadshed provides support for rejecting requests the service
+// doesn't have the capacity to handle, instead of letting them queue up.
+// The number of concurrent requests is limited, and the limit adapts to the
+// latency of the requests that are handled.
+package loadshed
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Set of errors returned to clients when a request isn't handled.
+var (
+	ErrOverloaded       = errors.New("service is overloaded")
+	ErrDeadlineExceeded = errors.New("request deadline exceeded")
+)
+
+// longWindow is the number of latency samples the long term latency is
+// averaged over. It's the latency the service has when it isn't overloaded.
+const longWindow = 600
+
+// Config represents information required to construct a limiter.
+//
+// The limit starts at InitialLimit and stays between MinLimit and MaxLimit.
+// Tolerance is how many times the long term latency a request can take
+// before the limit is reduced, and Smoothing is how quickly the limit moves
+// toward a new value, between 0 and 1.
+type Config struct {
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	Tolerance    float64
+	Smoothing    float64
+}
+
+// Limiter limits the number of requests handled at the same time. The limit
+// grows while latency stays close to the long term latency and shrinks when
+// requests start queueing and latency grows. This is the gradient algorithm
+// used by Netflix's concurrency-limits library.
+type Limiter struct {
+	mu       sync.Mutex
+	cfg      Config
+	limit    float64
+	inFlight int
+	longRTT  float64
+	samples  int
+}
+
+// New constructs a limiter.
+func New(cfg Config) *Limiter {
+	cfg.MinLimit = max(cfg.MinLimit, 1)
+	cfg.MaxLimit = max(cfg.MaxLimit, cfg.MinLimit)
+
+	return &Limiter{
+		cfg:   cfg,
+		limit: float64(min(max(cfg.InitialLimit, cfg.MinLimit), cfg.MaxLimit)),
+	}
+}
+
+// Acquire reserves capacity for a request. It reports false when the limit
+// is reached and the request should be rejected. Release must be called
+// when a request that was accepted is done.
+func (l *Limiter) Acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+
+	l.inFlight++
+
+	return true
+}
+
+// Release returns the capacity reserved by Acquire. The latency of the
+// request adjusts the limit when sample is set. Requests whose latency
+// doesn't depend on the load, like long running exports, shouldn't be
+// sampled.
+func (l *Limiter) Release(rtt time.Duration, sample bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+
+	if sample && rtt > 0 {
+		l.update(rtt.Seconds(), inFlight)
+	}
+}
+
+// Limit returns the current concurrency limit.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit)
+}
+
+// InFlight returns the number of requests holding capacity.
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.inFlight
+}
+
+// update adjusts the limit from the latency of a request that was handled
+// while inFlight requests were running.
+func (l *Limiter) update(rtt float64, inFlight int) {
+	l.samples++
+	switch {
+	case l.samples == 1:
+		l.longRTT = rtt
+	case l.samples < longWindow:
+		l.longRTT += (rtt - l.longRTT) / float64(l.samples)
+	default:
+		l.longRTT += (rtt - l.longRTT) * 2 / (longWindow + 1)
+	}
+
+	// After a period of overload the long term latency is inflated, so it's
+	// pulled down faster to recover the limit once latency is back to normal.
+	if l.longRTT/rtt > 2 {
+		l.longRTT *= 0.95
+	}
+
+	// The limit isn't grown when it isn't what's holding requests back.
+	if float64(inFlight) < l.limit/2 {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, l.cfg.Tolerance*l.longRTT/rtt))
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+
+	limit := l.limit*(1-l.cfg.Smoothing) + newLimit*l.cfg.Smoothing
+	l.limit = math.Max(float64(l.cfg.MinLimit), math.Min(float64(l.cfg.MaxLimit), limit))
+}
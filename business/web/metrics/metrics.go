@@ -3,8 +3,16 @@ package metrics
 
 import (
 	"context"
+	"database/sql"
 	"expvar"
+	"net/http"
 	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // This holds the single instance of the metrics value needed for
@@ -16,25 +24,96 @@ var m *metrics
 // =============================================================================
 
 // metrics represents the set of metrics we gather. These fields are
-// safe to be accessed concurrently thanks to expvar. No extra abstraction is required.
+// safe to be accessed concurrently thanks to expvar and prometheus. No extra
+// abstraction is required.
 type metrics struct {
-	goroutines *expvar.Int
+	goroutines expvar.Func
 	requests   *expvar.Int
 	errors     *expvar.Int
 	panics     *expvar.Int
+
+	registry        *prometheus.Registry
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	inFlight        *prometheus.GaugeVec
+	opaDuration     *prometheus.HistogramVec
+	shedLimit       prometheus.Gauge
+	shedDecisions   *prometheus.CounterVec
+	deadlines       *prometheus.CounterVec
 }
 
 // init constructs the metrics value that will be used to capture metrics.
 // The metrics value is stored in a package level variable since everything
 // inside of expvar is registered as a singleton. The use of once will make
 // sure this initialization only happens once.
+//
+// The prometheus metrics use their own registry instead of the default one
+// for the same reason the debug mux doesn't use the DefaultServeMux. A
+// dependency could otherwise register collectors without us knowing it.
 func init() {
 	m = &metrics{
-		goroutines: expvar.NewInt("goroutines"),
+		goroutines: func() any { return runtime.NumGoroutine() },
 		requests:   expvar.NewInt("requests"),
 		errors:     expvar.NewInt("errors"),
 		panics:     expvar.NewInt("panics"),
+
+		registry: prometheus.NewRegistry(),
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of handled requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of handled requests by route, method and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of requests currently being handled by route and method.",
+		}, []string{"route", "method"}),
+		opaDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "opa_evaluation_duration_seconds",
+			Help:    "Latency of OPA policy evaluations by rule and result.",
+			Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1},
+		}, []string{"rule", "result"}),
+		shedLimit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "loadshed_concurrency_limit",
+			Help: "Number of requests the adaptive limiter lets run at the same time.",
+		}),
+		shedDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "loadshed_decisions_total",
+			Help: "Number of requests accepted or rejected by the adaptive limiter.",
+		}, []string{"decision"}),
+		deadlines: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_request_deadlines_exceeded_total",
+			Help: "Number of requests that ran out of time by route and method.",
+		}, []string{"route", "method"}),
 	}
+
+	expvar.Publish("goroutines", m.goroutines)
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestsTotal,
+		m.requestDuration,
+		m.inFlight,
+		m.opaDuration,
+		m.shedLimit,
+		m.shedDecisions,
+		m.deadlines,
+	)
+}
+
+// Handler returns the handler that serves the prometheus metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB adds the connection pool statistics of the specified database
+// to the prometheus metrics.
+func RegisterDB(db *sql.DB, dbName string) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, dbName))
 }
 
 // =============================================================================
@@ -48,15 +127,6 @@ func Set(ctx context.Context) context.Context {
 	return context.WithValue(ctx, key, m)
 }
 
-// AddGoroutines refreshes the goroutine metric every 100 requests.
-func AddGoroutines(ctx context.Context) {
-	if v, ok := ctx.Value(key).(*metrics); ok {
-		if v.requests.Value()%100 == 0 {
-			v.goroutines.Set(int64(runtime.NumGoroutine()))
-		}
-	}
-}
-
 // AddRequests increments the request metric by 1.
 func AddRequests(ctx context.Context) {
 	if v, ok := ctx.Value(key).(*metrics); ok {
@@ -77,3 +147,54 @@ func AddPanics(ctx context.Context) {
 		v.panics.Add(1)
 	}
 }
+
+// AddInFlight adjusts the number of in-flight requests for the route by
+// the specified delta.
+func AddInFlight(ctx context.Context, route string, method string, delta float64) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		v.inFlight.WithLabelValues(route, method).Add(delta)
+	}
+}
+
+// ObserveRequest records a handled request and its latency.
+func ObserveRequest(ctx context.Context, route string, method string, status int, duration time.Duration) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		code := strconv.Itoa(status)
+		v.requestsTotal.WithLabelValues(route, method, code).Inc()
+		v.requestDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+	}
+}
+
+// ObserveOPA records the latency of an OPA policy evaluation. Evaluations
+// happen outside of the request metrics context, like in auth, so this
+// doesn't depend on Set being called.
+func ObserveOPA(rule string, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+
+	m.opaDuration.WithLabelValues(rule, result).Observe(duration.Seconds())
+}
+
+// ObserveShed records a decision of the adaptive limiter and its current
+// limit.
+func ObserveShed(ctx context.Context, accepted bool, limit int) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		decision := "accepted"
+		if !accepted {
+			decision = "rejected"
+		}
+
+		v.shedDecisions.WithLabelValues(decision).Inc()
+		v.shedLimit.Set(float64(limit))
+	}
+}
+
+// AddDeadlineExceeded increments the number of requests for the route that
+// ran out of time by 1.
+func AddDeadlineExceeded(ctx context.Context, route string, method string) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		v.deadlines.WithLabelValues(route, method).Inc()
+	}
+}
@@ -0,0 +1,210 @@
+// Package ratelimit provides support for limiting the rate of requests a
+// client can make using a token bucket per client.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrLimitExceeded is returned when a client has no requests left.
+var ErrLimitExceeded = errors.New("rate limit exceeded")
+
+// Limit defines the size of a token bucket. A bucket holds up to Requests
+// tokens and refills completely over the Window.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Validate checks the limit can be used: a bucket needs requests to hold and
+// a window to refill over.
+func (l Limit) Validate() error {
+	if l.Requests <= 0 {
+		return fmt.Errorf("requests must be positive, got %d", l.Requests)
+	}
+	if l.Window <= 0 {
+		return fmt.Errorf("window must be positive, got %s", l.Window)
+	}
+	return nil
+}
+
+// rate returns the number of tokens added to the bucket per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// Policy defines the limits applied to a route. Role limits take precedence
+// over the default when the authenticated user holds the role.
+type Policy struct {
+	Default Limit
+	Roles   map[string]Limit
+}
+
+// Validate checks the default limit and the limits of the roles.
+func (p Policy) Validate() error {
+	if err := p.Default.Validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+
+	for role, limit := range p.Roles {
+		if err := limit.Validate(); err != nil {
+			return fmt.Errorf("role %s: %w", role, err)
+		}
+	}
+
+	return nil
+}
+
+// limitFor returns the most generous limit for the set of roles.
+func (p Policy) limitFor(roles []string) Limit {
+	limit := p.Default
+	found := false
+
+	for _, role := range roles {
+		l, exists := p.Roles[role]
+		if !exists {
+			continue
+		}
+
+		if !found || l.rate() > limit.rate() {
+			limit = l
+			found = true
+		}
+	}
+
+	return limit
+}
+
+// Result provides the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Store defines the behavior required to keep track of token buckets. An
+// implementation backed by a shared system allows replicas of the service
+// to enforce the same limits.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// =============================================================================
+
+// Config represents information required to construct a limiter.
+type Config struct {
+	Log            *zap.SugaredLogger
+	Store          Store
+	TrustedProxies []string
+}
+
+// Limiter applies policies to requests.
+type Limiter struct {
+	log     *zap.SugaredLogger
+	store   Store
+	proxies []netip.Prefix
+}
+
+// New constructs a limiter. Trusted proxies can be provided as single
+// addresses or CIDR ranges.
+func New(cfg Config) (*Limiter, error) {
+	proxies := make([]netip.Prefix, 0, len(cfg.TrustedProxies))
+	for _, proxy := range cfg.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("parsing trusted proxy %q: %w", proxy, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing trusted proxy %q: %w", proxy, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+
+	l := Limiter{
+		log:     cfg.Log,
+		store:   cfg.Store,
+		proxies: proxies,
+	}
+
+	return &l, nil
+}
+
+// Allow takes a token for the key under the policy. If the store fails the
+// request is allowed, since rejecting all traffic is worse than not limiting
+// it for a moment.
+func (l *Limiter) Allow(ctx context.Context, key string, policy Policy, roles []string) Result {
+	limit := policy.limitFor(roles)
+
+	res, err := l.store.Take(ctx, key, limit, time.Now())
+	if err != nil {
+		l.log.Errorw("ratelimit", "ERROR", err, "key", key)
+		return Result{Allowed: true, Limit: limit.Requests, Remaining: limit.Requests}
+	}
+
+	return res
+}
+
+// ClientIP returns the address of the client that made the request. The
+// X-Forwarded-For header is only honoured when the request came through a
+// trusted proxy, and then the right-most address that isn't a trusted proxy
+// is used since everything to the left of it can be forged by the client.
+func (l *Limiter) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !l.trusted(addr) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+
+		if !l.trusted(hop) {
+			return hop.String()
+		}
+
+		host = hop.String()
+	}
+
+	return host
+}
+
+func (l *Limiter) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, proxy := range l.proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
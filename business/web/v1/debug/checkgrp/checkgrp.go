@@ -15,12 +15,15 @@ import (
 
 // Handlers manages the set of check endpoints.
 type Handlers struct {
-	Build string
-	Log   *zap.SugaredLogger
-	DB    *sqlx.DB
+	Build    string
+	Log      *zap.SugaredLogger
+	DB       *sqlx.DB
+	Draining <-chan struct{}
 }
 
 // Readiness checks if the database is ready and if not will return a 500 status.
+// Once the service starts shutting down it returns a 503 status, so no new
+// traffic is sent while the requests in flight are drained.
 // Do not respond by just returning an error because further up in the call
 // stack it will interpret that as a non-trusted error.
 func (h Handlers) Readiness(w http.ResponseWriter, r *http.Request) {
@@ -30,9 +33,16 @@ func (h Handlers) Readiness(w http.ResponseWriter, r *http.Request) {
 	status := "ok"
 	statusCode := http.StatusOK
 
-	if err := database.StatusCheck(ctx, h.DB); err != nil {
-		status = "db not ready"
-		statusCode = http.StatusInternalServerError
+	select {
+	case <-h.Draining:
+		status = "shutting down"
+		statusCode = http.StatusServiceUnavailable
+
+	default:
+		if err := database.StatusCheck(ctx, h.DB); err != nil {
+			status = "db not ready"
+			statusCode = http.StatusInternalServerError
+		}
 	}
 
 	data := struct {
@@ -4,6 +4,7 @@ package debug
 import (
 	"expvar"
 	"github.com/jmoiron/sqlx"
+	"github.com/shawnzxx/service/business/web/metrics"
 	"github.com/shawnzxx/service/business/web/v1/debug/checkgrp"
 	"go.uber.org/zap"
 	"net/http"
@@ -31,16 +32,19 @@ func StandardLibraryMux() *http.ServeMux {
 // debug application routes for the service. This bypassing the use of the
 // DefaultServerMux. Using the DefaultServerMux would be a security risk since
 // a dependency could inject a handler into our service without us knowing it.
-func Mux(build string, log *zap.SugaredLogger, db *sqlx.DB) http.Handler {
+// The readiness check fails once the draining channel is closed.
+func Mux(build string, log *zap.SugaredLogger, db *sqlx.DB, draining <-chan struct{}) http.Handler {
 	mux := StandardLibraryMux()
 
 	cgh := checkgrp.Handlers{
-		Build: build,
-		Log:   log,
-		DB:    db,
+		Build:    build,
+		Log:      log,
+		DB:       db,
+		Draining: draining,
 	}
 	mux.HandleFunc("/debug/readiness", cgh.Readiness)
 	mux.HandleFunc("/debug/liveness", cgh.Liveness)
+	mux.Handle("/metrics", metrics.Handler())
 
 	return mux
 }
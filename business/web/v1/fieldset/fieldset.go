@@ -0,0 +1,73 @@
+// Package fieldset provides support for letting clients select the fields
+// of the values in a response, and the related resources to embed in them.
+package fieldset
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shawnzxx/service/business/sys/validate"
+)
+
+// Parse returns the fields listed in the fields query string, like
+// fields=id,name. Each must be one of the allowed fields. No fields are
+// returned when none are listed, which means all of them.
+func Parse(r *http.Request, allowed map[string]struct{}) ([]string, error) {
+	return parseList(r, "fields", allowed)
+}
+
+// ParseInclude returns the related resources listed in the include query
+// string, like include=products. Each must be one of the allowed ones.
+func ParseInclude(r *http.Request, allowed map[string]struct{}) ([]string, error) {
+	return parseList(r, "include", allowed)
+}
+
+// Columns returns the columns that are selected, in the order of the
+// columns. All of them are selected when there are no fields.
+func Columns(columns []string, fields []string) []string {
+	if len(fields) == 0 {
+		return columns
+	}
+
+	selected := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		selected[field] = struct{}{}
+	}
+
+	var cols []string
+	for _, column := range columns {
+		if _, exists := selected[column]; exists {
+			cols = append(cols, column)
+		}
+	}
+
+	return cols
+}
+
+func parseList(r *http.Request, key string, allowed map[string]struct{}) ([]string, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	var list []string
+	seen := make(map[string]struct{})
+
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+
+		if _, exists := allowed[name]; !exists {
+			return nil, validate.NewFieldsError(key, fmt.Errorf("unknown field %q", name))
+		}
+
+		if _, exists := seen[name]; exists {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		list = append(list, name)
+	}
+
+	return list, nil
+}
@@ -6,15 +6,65 @@ import (
 
 	"github.com/shawnzxx/service/business/web/auth"
 	"github.com/shawnzxx/service/foundation/web"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// Authenticate validates a JWT from the `Authorization` header.
+// Authenticate validates a JWT from the `Authorization` header. A caller
+// that presented a verified client certificate and no token is
+// authenticated by the certificate instead. The identity of the certificate
+// is added to the claims either way.
 func Authenticate(a *auth.Auth) web.Middleware {
 	m := func(handler web.Handler) web.Handler {
 		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-			claims, err := a.Authenticate(ctx, r.Header.Get("authorization"))
+			client, hasClient := clientCertificate(r)
+			bearer := r.Header.Get("authorization")
+
+			spanCtx, span := web.AddSpan(ctx, "business.web.v1.mid.authenticate")
+			var claims auth.Claims
+			var err error
+			switch {
+			case bearer == "" && hasClient:
+				claims, err = a.AuthenticateClient(spanCtx, client)
+			default:
+				claims, err = a.Authenticate(spanCtx, bearer)
+				if err == nil && hasClient {
+					claims.Client = &client
+				}
+			}
+			span.End()
+
+			if err != nil {
+				return auth.NewAuthError("authenticate: failed: %w", err)
+			}
+
+			// The actor of an impersonated request is kept with the request
+			// values, so the request is logged against the admin too.
+			if claims.Impersonated() {
+				web.GetValues(ctx).Actor = claims.Actor.Subject
+			}
+
+			ctx = auth.SetClaims(ctx, claims)
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// AuthenticateChallenge validates a multi-factor challenge token from the
+// `Authorization` header. Regular tokens are rejected.
+func AuthenticateChallenge(a *auth.Auth) web.Middleware {
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			spanCtx, span := web.AddSpan(ctx, "business.web.v1.mid.authenticatechallenge")
+			claims, err := a.AuthenticateChallenge(spanCtx, r.Header.Get("authorization"))
+			span.End()
+
 			if err != nil {
-				return auth.NewAuthError("authenticate: failed: %s", err)
+				return auth.NewAuthError("authenticate: failed: %w", err)
 			}
 
 			ctx = auth.SetClaims(ctx, claims)
@@ -38,8 +88,12 @@ func Authorize(a *auth.Auth, rule string) web.Middleware {
 				return auth.NewAuthError("authorize: you are not authorized for that action, no claims")
 			}
 
-			if err := a.Authorize(ctx, claims, rule); err != nil {
-				return auth.NewAuthError("authorize: you are not authorized for that action, claims[%v] rule[%v]: %s", claims.Roles, rule, err)
+			spanCtx, span := web.AddSpan(ctx, "business.web.v1.mid.authorize", attribute.String("rule", rule))
+			err := a.Authorize(spanCtx, claims, web.Param(r, "user_id"), rule)
+			span.End()
+
+			if err != nil {
+				return auth.NewAuthError("authorize: you are not authorized for that action, claims[%v] rule[%v]: %w: %s", claims.Roles, rule, auth.ErrForbidden, err)
 			}
 
 			return handler(ctx, w, r)
@@ -50,3 +104,14 @@ func Authorize(a *auth.Auth, rule string) web.Middleware {
 
 	return m
 }
+
+// clientCertificate returns the identity of the client certificate of the
+// connection. Only a certificate the server verified against the client CAs
+// is used.
+func clientCertificate(r *http.Request) (auth.Client, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return auth.Client{}, false
+	}
+
+	return auth.NewClient(r.TLS.VerifiedChains[0][0]), true
+}
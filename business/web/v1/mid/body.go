@@ -0,0 +1,24 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// MaxBodySize limits the size of the request body the route will accept. It
+// replaces web.DefaultMaxBodySize for the route.
+func MaxBodySize(n int64) web.Middleware {
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			web.SetMaxBodySize(w, r, n)
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
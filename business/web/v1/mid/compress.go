@@ -0,0 +1,321 @@
+package mid
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// CompressConfig defines which responses are compressed. Responses smaller
+// than MinSize bytes are sent as is, since compressing them saves little and
+// costs CPU. Only responses with one of the ContentTypes are compressed.
+type CompressConfig struct {
+	MinSize      int
+	ContentTypes []string
+}
+
+// Compress compresses responses with brotli or gzip when the client accepts
+// it in the Accept-Encoding header. Responses are buffered up to the minimum
+// size before deciding, and streamed responses are compressed from their
+// first flush.
+func Compress(cfg CompressConfig) web.Middleware {
+	allowed := make(map[string]bool, len(cfg.ContentTypes))
+	for _, ct := range cfg.ContentTypes {
+		allowed[strings.ToLower(strings.TrimSpace(ct))] = true
+	}
+
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			coding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if coding == "" || r.Method == http.MethodHead {
+				return handler(ctx, w, r)
+			}
+
+			cw := compressWriter{
+				ResponseWriter: w,
+				coding:         coding,
+				ifNoneMatch:    r.Header.Get("If-None-Match"),
+				minSize:        cfg.MinSize,
+				allowed:        allowed,
+			}
+			defer cw.close()
+
+			return handler(ctx, &cw, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// Set of content codings that are supported, in order of preference.
+const (
+	codingBrotli = "br"
+	codingGzip   = "gzip"
+)
+
+// negotiateEncoding picks the supported content coding with the highest
+// quality value in the Accept-Encoding header, preferring brotli on a tie.
+// An empty string is returned when the response shouldn't be compressed.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	q := map[string]float64{}
+	wildcard := -1.0
+
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		value := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, v, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(name) != "q" {
+				continue
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				f = 0
+			}
+			value = f
+		}
+
+		switch coding {
+		case "*":
+			wildcard = value
+		case codingBrotli, codingGzip:
+			q[coding] = value
+		}
+	}
+
+	var best string
+	var bestQ float64
+	for _, coding := range []string{codingBrotli, codingGzip} {
+		value, exists := q[coding]
+		if !exists {
+			value = wildcard
+		}
+		if value > bestQ {
+			best, bestQ = coding, value
+		}
+	}
+
+	return best
+}
+
+// =============================================================================
+
+// Set of compression levels that balance speed and size for responses that
+// are compressed on every request.
+const (
+	brotliLevel = 4
+	gzipLevel   = gzip.DefaultCompression
+)
+
+// encoder is the behavior shared by the brotli and gzip writers.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoders = map[string]*sync.Pool{
+	codingBrotli: {
+		New: func() any {
+			return brotli.NewWriterLevel(io.Discard, brotliLevel)
+		},
+	},
+	codingGzip: {
+		New: func() any {
+			w, _ := gzip.NewWriterLevel(io.Discard, gzipLevel)
+			return w
+		},
+	},
+}
+
+// compressWriter holds back the start of the response until it knows if the
+// response should be compressed. The status code in the web values is set by
+// web.Respond before writing, so it's correct whether or not the response
+// is compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	coding      string
+	ifNoneMatch string
+	minSize     int
+	allowed     map[string]bool
+	status      int
+	buf         []byte
+	committed   bool
+	enc         encoder
+}
+
+// WriteHeader holds back the status code until the response is committed.
+// Responses that can't have a body are committed right away.
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	switch {
+	case cw.committed, cw.status != 0:
+		return
+
+	case statusCode < http.StatusOK:
+		cw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	cw.status = statusCode
+
+	if !bodyAllowed(statusCode) {
+		cw.commit(false)
+	}
+}
+
+// Write buffers the data until there is enough to decide if the response is
+// worth compressing.
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if cw.committed {
+		if cw.enc != nil {
+			return cw.enc.Write(data)
+		}
+		return cw.ResponseWriter.Write(data)
+	}
+
+	cw.buf = append(cw.buf, data...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.commit(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// FlushError sends the buffered data to the client. It's used by
+// http.ResponseController, so streamed responses are compressed as they go.
+func (cw *compressWriter) FlushError() error {
+	if !cw.committed {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		if err := cw.commit(true); err != nil {
+			return err
+		}
+	}
+
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the original writer for http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// commit writes the status code and headers, and the buffered data. The
+// response is compressed when compress is set and the content type allows.
+func (cw *compressWriter) commit(compress bool) error {
+	cw.committed = true
+
+	h := cw.Header()
+
+	if len(cw.buf) > 0 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if compress && bodyAllowed(cw.status) && h.Get("Content-Encoding") == "" && cw.compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.coding)
+
+		// The compressed bytes are a different representation, which needs
+		// a strong entity tag of its own.
+		if etag := h.Get("ETag"); etag != "" {
+			h.Set("ETag", web.CodedETag(etag, cw.coding))
+		}
+
+		cw.enc = encoders[cw.coding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	// A 304 has no body to tell if it would have been compressed, so it
+	// carries the compressed tag when that's the one the client has.
+	if cw.status == http.StatusNotModified {
+		if etag := h.Get("ETag"); etag != "" && strings.Contains(cw.ifNoneMatch, web.CodedETag(etag, cw.coding)) {
+			h.Set("ETag", web.CodedETag(etag, cw.coding))
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// close completes the response once the handler has returned.
+func (cw *compressWriter) close() {
+	if !cw.committed {
+		if cw.status == 0 {
+			return
+		}
+		cw.commit(false)
+	}
+
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(io.Discard)
+		encoders[cw.coding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+func (cw *compressWriter) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return cw.allowed[mediaType]
+}
+
+// bodyAllowed reports if a response with the status code can have a body.
+func bodyAllowed(statusCode int) bool {
+	switch {
+	case statusCode < http.StatusOK,
+		statusCode == http.StatusNoContent,
+		statusCode == http.StatusNotModified:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,145 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// CORSConfig defines which cross origin requests are allowed. An origin can
+// be "*" to allow any origin, or use a wildcard for subdomains like
+// "https://*.example.com".
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// Validate checks the configuration can be served safely. Allowing
+// credentials from any origin would let every site on the web make
+// requests with the credentials of the user, so "*" and AllowCredentials
+// can't be combined; the trusted origins must be listed instead.
+func (cfg CORSConfig) Validate() error {
+	if !cfg.AllowCredentials {
+		return nil
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			return errors.New("credentials can't be allowed for every origin, list the allowed origins instead")
+		}
+	}
+
+	return nil
+}
+
+// Cors sets the response headers needed for Cross-Origin Resource Sharing.
+// It must be registered with web.App.EnableCORS so preflight requests are
+// answered for every route.
+func Cors(cfg CORSConfig) web.Middleware {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return handler(ctx, w, r)
+			}
+
+			w.Header().Add("Vary", "Origin")
+
+			allowed, wildcard := matchOrigin(cfg.AllowedOrigins, origin)
+			if !allowed {
+				return handler(ctx, w, r)
+			}
+
+			// Origins allowed by the "*" wildcard never get credentials, even
+			// when the configuration wasn't validated.
+			switch {
+			case wildcard:
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			default:
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if cfg.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			reqMethod := r.Header.Get("Access-Control-Request-Method")
+			if r.Method != http.MethodOptions || reqMethod == "" {
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+				return handler(ctx, w, r)
+			}
+
+			// This is a preflight request.
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			if !containsFold(cfg.AllowedMethods, reqMethod) {
+				return handler(ctx, w, r)
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// matchOrigin reports if the origin is allowed and if it was allowed by the
+// "*" wildcard.
+func matchOrigin(allowed []string, origin string) (bool, bool) {
+	for _, a := range allowed {
+		switch {
+		case a == "*":
+			return true, true
+
+		case strings.EqualFold(a, origin):
+			return true, false
+
+		case strings.Contains(a, "://*."):
+			scheme, domain, _ := strings.Cut(a, "://*")
+			prefix := scheme + "://"
+			if len(origin) > len(prefix)+len(domain) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(domain)) {
+				return true, false
+			}
+		}
+	}
+
+	return false, false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,9 +2,13 @@ package mid
 
 import (
 	"context"
-	"github.com/shawnzxx/service/business/sys/validate"
+	"errors"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/shawnzxx/service/business/sys/validate"
 	"github.com/shawnzxx/service/business/web/auth"
 	v1 "github.com/shawnzxx/service/business/web/v1"
 	"github.com/shawnzxx/service/foundation/web"
@@ -14,46 +18,36 @@ import (
 // Errors handles errors coming out of the call chain. It detects normal
 // application errors which are used to respond to the client in a uniform way.
 // Unexpected errors (status >= 500) are logged.
-func Errors(log *zap.SugaredLogger) web.Middleware {
+//
+// Errors are sent as application/problem+json documents. Clients of paths
+// under one of the legacy prefixes can still get the v1.ErrorResponse form
+// by asking for it: they accept application/json, and don't accept
+// application/problem+json as much.
+func Errors(log *zap.SugaredLogger, legacyPrefixes ...string) web.Middleware {
 	m := func(handler web.Handler) web.Handler {
 		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 			if err := handler(ctx, w, r); err != nil {
 				log.Errorw("ERROR", "trace_id", web.GetTraceID(ctx), "message", err)
 
-				var er v1.ErrorResponse
-				var status int
+				// A streamed response has already been sent, so it can only
+				// be cut short.
+				if web.IsStreamError(err) {
+					return nil
+				}
 
+				var respErr error
 				switch {
-				case validate.IsFieldErrors(err):
-					fieldErrors := validate.GetFieldErrors(err)
-					er = v1.ErrorResponse{
-						Error:  "data validation error",
-						Fields: fieldErrors.Fields(),
-					}
-					status = http.StatusBadRequest
-
-				case v1.IsRequestError(err):
-					reqErr := v1.GetRequestError(err)
-					er = v1.ErrorResponse{
-						Error: reqErr.Error(),
-					}
-					status = reqErr.Status
-
-				case auth.IsAuthError(err):
-					er = v1.ErrorResponse{
-						Error: http.StatusText(http.StatusUnauthorized),
-					}
-					status = http.StatusUnauthorized
+				case legacyErrors(r, legacyPrefixes):
+					er, status := legacyResponse(err)
+					respErr = web.Respond(ctx, w, er, status)
 
 				default:
-					er = v1.ErrorResponse{
-						Error: http.StatusText(http.StatusInternalServerError),
-					}
-					status = http.StatusInternalServerError
+					p := problem(ctx, err)
+					respErr = web.RespondAs(ctx, w, p, p.Status, v1.ProblemContentType)
 				}
 
-				if err := web.Respond(ctx, w, er, status); err != nil {
-					return err
+				if respErr != nil {
+					return respErr
 				}
 
 				// If we receive the shutdown err we need to return it
@@ -71,3 +65,166 @@ func Errors(log *zap.SugaredLogger) web.Middleware {
 
 	return m
 }
+
+// legacyErrors reports if the error for the request should be sent in the
+// v1.ErrorResponse form. Wildcards in the Accept header don't ask for it.
+func legacyErrors(r *http.Request, prefixes []string) bool {
+	legacy := false
+	for _, prefix := range prefixes {
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, strings.TrimSuffix(prefix, "/")+"/") {
+			legacy = true
+			break
+		}
+	}
+
+	if !legacy {
+		return false
+	}
+
+	var jsonQ, problemQ float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, exists := params["q"]; exists {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case v1.ProblemContentType:
+			problemQ = max(problemQ, q)
+		}
+	}
+
+	return jsonQ > problemQ
+}
+
+// problem converts the error into a problem document. Only errors the
+// application expects are described, anything else is an internal error
+// whose details stay in the logs.
+func problem(ctx context.Context, err error) v1.Problem {
+	code, cataloged, found := v1.LookupCode(err)
+	instance := web.GetTraceID(ctx)
+
+	switch {
+	case validate.IsFieldErrors(err):
+		p := v1.NewProblem(v1.CodeValidation, v1.CodeValidation.Status, "", instance)
+		p.Fields = validate.GetFieldErrors(err).Fields()
+		return p
+
+	case web.IsDecodeError(err):
+		decodeErr := web.GetDecodeError(err)
+		p := v1.NewProblem(v1.CodeValidation, v1.CodeValidation.Status, "", instance)
+		p.Fields = validate.GetFieldErrors(validate.NewFieldsError(decodeErr.Field, decodeErr.Err)).Fields()
+		return p
+
+	case v1.IsRequestError(err):
+		reqErr := v1.GetRequestError(err)
+		code, _, found := v1.LookupCode(reqErr.Err)
+		if !found {
+			code = v1.StatusCode(reqErr.Status)
+		}
+		return v1.NewProblem(code, reqErr.Status, reqErr.Error(), instance)
+
+	case auth.IsAuthError(err):
+		if !found {
+			return v1.NewProblem(v1.CodeUnauthenticated, v1.CodeUnauthenticated.Status, err.Error(), instance)
+		}
+
+		// An auth error is always a 401 or 403, whatever the code would
+		// mean elsewhere. The message of a failed authorization describes
+		// the claims and the policy, which is for the logs only.
+		status := code.Status
+		if status != http.StatusForbidden {
+			status = http.StatusUnauthorized
+		}
+		return v1.NewProblem(code, status, cataloged.Error(), instance)
+
+	case found && isWebError(cataloged):
+		return v1.NewProblem(code, code.Status, err.Error(), instance)
+	}
+
+	return v1.NewProblem(v1.CodeInternal, v1.CodeInternal.Status, "", instance)
+}
+
+// isWebError reports if the error is one of the errors of the web package
+// that describe a problem with the request rather than the application.
+func isWebError(err error) bool {
+	switch err {
+	case web.ErrBodyTooLarge, web.ErrUnsupportedMediaType, web.ErrRouteNotFound, web.ErrMethodNotAllowed:
+		return true
+	}
+
+	return false
+}
+
+// legacyResponse converts the error into the v1.ErrorResponse form.
+func legacyResponse(err error) (v1.ErrorResponse, int) {
+	switch {
+	case validate.IsFieldErrors(err):
+		fieldErrors := validate.GetFieldErrors(err)
+		er := v1.ErrorResponse{
+			Error:  "data validation error",
+			Fields: fieldErrors.Fields(),
+		}
+		return er, http.StatusBadRequest
+
+	case web.IsDecodeError(err):
+		decodeErr := web.GetDecodeError(err)
+		fieldErrors := validate.GetFieldErrors(validate.NewFieldsError(decodeErr.Field, decodeErr.Err))
+		er := v1.ErrorResponse{
+			Error:  "data validation error",
+			Fields: fieldErrors.Fields(),
+		}
+		return er, http.StatusBadRequest
+
+	case errors.Is(err, web.ErrBodyTooLarge):
+		er := v1.ErrorResponse{
+			Error: err.Error(),
+		}
+		return er, http.StatusRequestEntityTooLarge
+
+	case errors.Is(err, web.ErrUnsupportedMediaType):
+		er := v1.ErrorResponse{
+			Error: err.Error(),
+		}
+		return er, http.StatusUnsupportedMediaType
+
+	case errors.Is(err, web.ErrRouteNotFound):
+		er := v1.ErrorResponse{
+			Error: err.Error(),
+		}
+		return er, http.StatusNotFound
+
+	case errors.Is(err, web.ErrMethodNotAllowed):
+		er := v1.ErrorResponse{
+			Error: err.Error(),
+		}
+		return er, http.StatusMethodNotAllowed
+
+	case v1.IsRequestError(err):
+		reqErr := v1.GetRequestError(err)
+		er := v1.ErrorResponse{
+			Error: reqErr.Error(),
+		}
+		return er, reqErr.Status
+
+	case auth.IsAuthError(err):
+		er := v1.ErrorResponse{
+			Error: http.StatusText(http.StatusUnauthorized),
+		}
+		return er, http.StatusUnauthorized
+	}
+
+	er := v1.ErrorResponse{
+		Error: http.StatusText(http.StatusInternalServerError),
+	}
+	return er, http.StatusInternalServerError
+}
@@ -0,0 +1,80 @@
+package mid_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "github.com/shawnzxx/service/business/web/v1"
+	"github.com/shawnzxx/service/business/web/v1/mid"
+	"go.uber.org/zap"
+)
+
+// TestErrorsForm checks errors are sent as problem documents unless a client
+// of a legacy path asks for the legacy form.
+func TestErrorsForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		legacy bool
+	}{
+		{name: "no accept", path: "/v1/users"},
+		{name: "any", path: "/v1/users", accept: "*/*"},
+		{name: "problem", path: "/v1/users", accept: v1.ProblemContentType},
+		{name: "json", path: "/v1/users", accept: "application/json", legacy: true},
+		{name: "json preferred", path: "/v1/users", accept: "application/problem+json;q=0.5, application/json", legacy: true},
+		{name: "both", path: "/v1/users", accept: "application/json, application/problem+json"},
+		{name: "json refused", path: "/v1/users", accept: "application/json;q=0, */*"},
+		{name: "other path", path: "/v2/users", accept: "application/json"},
+	}
+
+	log := zap.NewNop().Sugar()
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return v1.NewRequestError(errors.New("user is disabled"), http.StatusBadRequest)
+	}
+
+	h := mid.Errors(log, "/v1")(handler)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			if err := h(context.Background(), w, r); err != nil {
+				t.Fatalf("Should be able to respond with the error: %s", err)
+			}
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Should get a 400 status, got %d.", w.Code)
+			}
+
+			contentType := v1.ProblemContentType
+			if tt.legacy {
+				contentType = "application/json"
+			}
+
+			if ct := w.Header().Get("Content-Type"); ct != contentType {
+				t.Fatalf("Should get the content type %q, got %q.", contentType, ct)
+			}
+
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Should be able to decode the response: %s", err)
+			}
+
+			_, hasError := body["error"]
+			_, hasStatus := body["status"]
+			if hasError != tt.legacy || hasStatus == tt.legacy {
+				t.Errorf("Should get the legacy form %t, got %v.", tt.legacy, body)
+			}
+		})
+	}
+}
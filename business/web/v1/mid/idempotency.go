@@ -0,0 +1,172 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/shawnzxx/service/business/sys/validate"
+	"github.com/shawnzxx/service/business/web/auth"
+	"github.com/shawnzxx/service/business/web/idempotency"
+	v1 "github.com/shawnzxx/service/business/web/v1"
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// Set of headers used for idempotent requests.
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKey is the longest idempotency key that's accepted.
+const maxIdempotencyKey = 255
+
+// replayHeaders are the response headers that are recorded and replayed.
+// Headers like X-Trace-ID describe the retry rather than the first request.
+var replayHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Idempotency replays the response to the first request made with an
+// Idempotency-Key header for retries made with the same key. Keys are
+// scoped to the client and route, so this should come after Authenticate.
+// A retry while the first request is still being processed is rejected with
+// 409, and reusing a key for a different request body is rejected with 422.
+// Requests without the header are processed as usual.
+func Idempotency(rc *idempotency.Recorder) web.Middleware {
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			idemKey := r.Header.Get(idempotencyKeyHeader)
+			if idemKey == "" {
+				return handler(ctx, w, r)
+			}
+
+			if len(idemKey) > maxIdempotencyKey {
+				return validate.NewFieldsError(idempotencyKeyHeader, errors.New("must be at most 255 characters"))
+			}
+
+			body, err := web.ReadBody(r)
+			if err != nil {
+				return err
+			}
+
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+
+			client := "ip:" + host
+			if subject := auth.GetClaims(ctx).Subject; subject != "" {
+				client = "sub:" + subject
+			}
+
+			route := r.Method + " " + web.GetValues(ctx).Route
+			key := route + " " + client + " " + idemKey
+
+			sum := sha256.Sum256(append([]byte(route+"\n"), body...))
+			fingerprint := hex.EncodeToString(sum[:])
+
+			resp, err := rc.Begin(ctx, key, fingerprint)
+			switch {
+			case errors.Is(err, idempotency.ErrInFlight):
+				w.Header().Set("Retry-After", "1")
+				return v1.NewRequestError(err, http.StatusConflict)
+
+			case errors.Is(err, idempotency.ErrKeyReused):
+				return v1.NewRequestError(err, http.StatusUnprocessableEntity)
+
+			case resp != nil:
+				return replay(ctx, w, *resp)
+			}
+
+			// The key is released unless a response is recorded, which
+			// includes the handler panicking.
+			completed := false
+			defer func() {
+				if !completed {
+					rc.Release(ctx, key)
+				}
+			}()
+
+			rw := recordWriter{ResponseWriter: w}
+			if err := handler(ctx, &rw, r); err != nil {
+				return err
+			}
+
+			// Server errors are worth retrying, so they aren't recorded.
+			if rw.statusCode == 0 || rw.statusCode >= http.StatusInternalServerError {
+				return nil
+			}
+
+			header := make(http.Header)
+			for _, name := range replayHeaders {
+				if values := w.Header().Values(name); len(values) > 0 {
+					header[name] = values
+				}
+			}
+
+			rc.Complete(ctx, key, idempotency.Response{
+				StatusCode: rw.statusCode,
+				Header:     header,
+				Body:       rw.body.Bytes(),
+			})
+			completed = true
+
+			return nil
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// replay writes the recorded response to the client.
+func replay(ctx context.Context, w http.ResponseWriter, resp idempotency.Response) error {
+	web.SetStatusCode(ctx, resp.StatusCode)
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotencyReplayedHeader, "true")
+	w.WriteHeader(resp.StatusCode)
+
+	if _, err := w.Write(resp.Body); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// recordWriter keeps a copy of the response while it's written to the client.
+type recordWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+// WriteHeader records the status code.
+func (rw *recordWriter) WriteHeader(statusCode int) {
+	if rw.statusCode == 0 {
+		rw.statusCode = statusCode
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the data.
+func (rw *recordWriter) Write(data []byte) (int, error) {
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusOK
+	}
+	rw.body.Write(data)
+	return rw.ResponseWriter.Write(data)
+}
+
+// Unwrap returns the original writer for http.ResponseController.
+func (rw *recordWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,88 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/shawnzxx/service/business/web/loadshed"
+	"github.com/shawnzxx/service/business/web/metrics"
+	v1 "github.com/shawnzxx/service/business/web/v1"
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// Shed rejects requests with 503 when the limiter has no capacity left, so
+// requests don't pile up while the service is overloaded. It must run inside
+// the Metrics middleware for the decisions to be recorded. The streams are
+// the routes of event streams, which are told apart by their route rather
+// than anything the client sends.
+func Shed(l *loadshed.Limiter, streams ...string) web.Middleware {
+	isStream := make(map[string]struct{}, len(streams))
+	for _, route := range streams {
+		isStream[route] = struct{}{}
+	}
+
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if !l.Acquire() {
+				metrics.ObserveShed(ctx, false, l.Limit())
+
+				w.Header().Set("Retry-After", "1")
+				return v1.NewRequestError(loadshed.ErrOverloaded, http.StatusServiceUnavailable)
+			}
+
+			metrics.ObserveShed(ctx, true, l.Limit())
+
+			// An event stream stays open until the client goes away, so it
+			// would hold its capacity for good. It's only admitted when
+			// there's capacity and then gives it back straight away.
+			if _, exists := isStream[web.GetValues(ctx).Route]; exists {
+				l.Release(0, false)
+				return handler(ctx, w, r)
+			}
+
+			// The latency of a streamed export depends on its size rather
+			// than the load, so it isn't used to adapt the limit.
+			start := time.Now()
+			defer func() {
+				l.Release(time.Since(start), web.StreamType(r) == "")
+			}()
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// Deadline limits the time the route has to handle a request. The context
+// of the request is cancelled at the deadline, which stops the database
+// queries made with it, and the request fails with 503.
+func Deadline(d time.Duration) web.Middleware {
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			err := handler(ctx, w, r)
+			if err == nil || web.IsStreamError(err) || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return err
+			}
+
+			v := web.GetValues(ctx)
+			metrics.AddDeadlineExceeded(ctx, v.Route, r.Method)
+
+			// The original error is kept for the logs, while the client is
+			// only told the deadline passed.
+			return fmt.Errorf("%w: %w", v1.NewRequestError(loadshed.ErrDeadlineExceeded, http.StatusServiceUnavailable), err)
+		}
+
+		return h
+	}
+
+	return m
+}
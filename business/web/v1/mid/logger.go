@@ -24,13 +24,20 @@ func Logger(log *zap.SugaredLogger) web.Middleware {
 				path = fmt.Sprintf("%s?%s", path, r.URL.RawQuery)
 			}
 
-			log.Infow("request started", "trace_id", v.TraceID, "method", r.Method, "path", path,
+			log.Infow("request started", "trace_id", v.TraceID, "request_id", v.RequestID, "method", r.Method, "path", path,
 				"remoteaddr", r.RemoteAddr)
 
 			err := handler(ctx, w, r)
 
-			log.Infow("request completed", "trace_id", v.TraceID, "method", r.Method, "path", path,
-				"remoteaddr", r.RemoteAddr, "statuscode", v.StatusCode, "since", time.Since(v.Now))
+			kv := []any{"trace_id", v.TraceID, "request_id", v.RequestID, "method", r.Method, "path", path,
+				"remoteaddr", r.RemoteAddr, "statuscode", v.StatusCode, "since", time.Since(v.Now)}
+
+			// Impersonated requests name the admin acting as the user.
+			if v.Actor != "" {
+				kv = append(kv, "actor", v.Actor)
+			}
+
+			log.Infow("request completed", kv...)
 
 			return err
 		}
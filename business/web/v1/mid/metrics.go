@@ -3,23 +3,30 @@ package mid
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/shawnzxx/service/business/web/metrics"
 	"github.com/shawnzxx/service/foundation/web"
 )
 
-// Metrics updates program counters.
+// Metrics updates program counters. It must run outside of the Errors
+// middleware so the final status code of the response is known.
 func Metrics() web.Middleware {
 	m := func(handler web.Handler) web.Handler {
 		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 			ctx = metrics.Set(ctx)
 
+			v := web.GetValues(ctx)
+
+			metrics.AddInFlight(ctx, v.Route, r.Method, 1)
+			defer metrics.AddInFlight(ctx, v.Route, r.Method, -1)
+
 			err := handler(ctx, w, r)
 
 			metrics.AddRequests(ctx)
-			metrics.AddGoroutines(ctx)
+			metrics.ObserveRequest(ctx, v.Route, r.Method, v.StatusCode, time.Since(v.Now))
 
-			if err != nil {
+			if err != nil || v.StatusCode >= http.StatusBadRequest {
 				metrics.AddErrors(ctx)
 			}
 
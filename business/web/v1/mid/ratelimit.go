@@ -0,0 +1,58 @@
+package mid
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shawnzxx/service/business/web/auth"
+	"github.com/shawnzxx/service/business/web/ratelimit"
+	v1 "github.com/shawnzxx/service/business/web/v1"
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// RateLimit limits the number of requests a client can make to the route. A
+// client is identified by the subject of its claims when authenticated and
+// by its address otherwise, so this should come after Authenticate.
+func RateLimit(l *ratelimit.Limiter, policy ratelimit.Policy) web.Middleware {
+	m := func(handler web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			claims := auth.GetClaims(ctx)
+
+			client := "ip:" + l.ClientIP(r)
+			if claims.Subject != "" {
+				client = "sub:" + claims.Subject
+			}
+
+			key := r.Method + " " + web.GetValues(ctx).Route + " " + client
+
+			roles := make([]string, len(claims.Roles))
+			for i, role := range claims.Roles {
+				roles[i] = role.Name()
+			}
+
+			res := l.Allow(ctx, key, policy, roles)
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+				return v1.NewRequestError(ratelimit.ErrLimitExceeded, http.StatusTooManyRequests)
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,139 @@
+package paging
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/shawnzxx/service/business/data/order"
+)
+
+// Cursor marks where a page starts, by the order of the results and the
+// row the page starts after, or ends before when it's the page before.
+type Cursor struct {
+	OrderBy []order.By
+	Seek    order.Seek
+}
+
+// cursorToken is the form a cursor takes in its token.
+type cursorToken struct {
+	OrderBy  [][2]string `json:"o"`
+	Values   []string    `json:"v"`
+	Backward bool        `json:"b,omitempty"`
+}
+
+// String returns the token of the cursor, which clients pass back as is.
+func (c Cursor) String() string {
+	tkn := cursorToken{
+		OrderBy:  make([][2]string, len(c.OrderBy)),
+		Values:   c.Seek.Values,
+		Backward: c.Seek.Backward,
+	}
+	for i, by := range c.OrderBy {
+		tkn.OrderBy[i] = [2]string{by.Field, by.Direction}
+	}
+
+	data, _ := json.Marshal(tkn)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor parses the token of a cursor.
+func ParseCursor(token string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, errors.New("invalid cursor")
+	}
+
+	var tkn cursorToken
+	if err := json.Unmarshal(data, &tkn); err != nil || len(tkn.Values) == 0 {
+		return Cursor{}, errors.New("invalid cursor")
+	}
+
+	c := Cursor{
+		OrderBy: make([]order.By, len(tkn.OrderBy)),
+		Seek: order.Seek{
+			Values:   tkn.Values,
+			Backward: tkn.Backward,
+		},
+	}
+	for i, by := range tkn.OrderBy {
+		c.OrderBy[i] = order.NewBy(by[0], by[1])
+	}
+
+	return c, nil
+}
+
+// =============================================================================
+
+// Cursors holds the tokens of the cursors of the pages after and before a
+// page. They're empty when there's no such page.
+type Cursors struct {
+	Next string
+	Prev string
+}
+
+// NewCursors returns the cursors of the pages after and before the items
+// read for the page, which are returned without the extra row read in
+// cursor mode. The seekAfter function returns the seek that starts results
+// after an item.
+func NewCursors[T any](page Page, orderBy []order.By, items []T, seekAfter func(T, []order.By) order.Seek) ([]T, Cursors) {
+	var cursors Cursors
+
+	cursor := func(item T, backward bool) string {
+		seek := seekAfter(item, orderBy)
+		seek.Backward = backward
+		return Cursor{OrderBy: orderBy, Seek: seek}.String()
+	}
+
+	if page.Cursor == nil {
+		if len(items) > 0 && len(items) == page.RowsPerPage {
+			cursors.Next = cursor(items[len(items)-1], false)
+		}
+		if len(items) > 0 && page.Number > 1 {
+			cursors.Prev = cursor(items[0], true)
+		}
+		return items, cursors
+	}
+
+	backward := page.Cursor.Seek.Backward
+
+	// The extra row is the one furthest from the cursor, which is the
+	// first when reading backward.
+	more := len(items) > page.RowsPerPage
+	if more {
+		if backward {
+			items = items[len(items)-page.RowsPerPage:]
+		} else {
+			items = items[:page.RowsPerPage]
+		}
+	}
+
+	// Without items the page the client came from is found by turning the
+	// cursor around.
+	if len(items) == 0 {
+		turned := *page.Cursor
+		turned.Seek.Backward = !backward
+		if backward {
+			cursors.Next = turned.String()
+		} else {
+			cursors.Prev = turned.String()
+		}
+		return items, cursors
+	}
+
+	switch {
+	case backward:
+		cursors.Next = cursor(items[len(items)-1], false)
+		if more {
+			cursors.Prev = cursor(items[0], true)
+		}
+	default:
+		cursors.Prev = cursor(items[0], true)
+		if more {
+			cursors.Next = cursor(items[len(items)-1], false)
+		}
+	}
+
+	return items, cursors
+}
@@ -2,41 +2,98 @@
 package paging
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"strconv"
 
+	"github.com/shawnzxx/service/business/data/order"
 	"github.com/shawnzxx/service/business/sys/validate"
 )
 
-// Response is what is returned when a query call is performed.
+// Response is what is returned when a query call is performed. Next and
+// Prev are links to the pages after and before this one. NextCursor and
+// PrevCursor start those pages in cursor mode, even when this page was
+// requested by number.
 type Response[T any] struct {
-	Items       []T `json:"items"`
-	Total       int `json:"total"`
-	Page        int `json:"page"`
-	RowsPerPage int `json:"rowsPerPage"`
+	Items       []T    `json:"items"`
+	Total       int    `json:"total"`
+	Page        int    `json:"page,omitempty"`
+	RowsPerPage int    `json:"rowsPerPage"`
+	NextCursor  string `json:"nextCursor,omitempty"`
+	PrevCursor  string `json:"prevCursor,omitempty"`
+	Next        string `json:"next,omitempty"`
+	Prev        string `json:"prev,omitempty"`
 }
 
-// NewResponse constructs a reponse value for a web response.
-func NewResponse[T any](items []T, total int, page int, rowsPrePage int) Response[T] {
-	return Response[T]{
+// NewResponse constructs a reponse value for a web response. The links
+// keep the query string of the request, so the pages they point to have
+// the same filter and order.
+func NewResponse[T any](r *http.Request, items []T, total int, page Page, cursors Cursors) Response[T] {
+	resp := Response[T]{
 		Items:       items,
 		Total:       total,
-		Page:        page,
-		RowsPerPage: rowsPrePage,
+		RowsPerPage: page.RowsPerPage,
+		NextCursor:  cursors.Next,
+		PrevCursor:  cursors.Prev,
 	}
+
+	if page.Cursor != nil {
+		if cursors.Next != "" {
+			resp.Next = link(r, "cursor", cursors.Next)
+		}
+		if cursors.Prev != "" {
+			resp.Prev = link(r, "cursor", cursors.Prev)
+		}
+		return resp
+	}
+
+	resp.Page = page.Number
+	if page.Number*page.RowsPerPage < total {
+		resp.Next = link(r, "page", strconv.Itoa(page.Number+1))
+	}
+	if page.Number > 1 {
+		resp.Prev = link(r, "page", strconv.Itoa(page.Number-1))
+	}
+
+	return resp
+}
+
+// link returns the path of the request with the page or cursor replaced.
+func link(r *http.Request, key string, value string) string {
+	values := r.URL.Query()
+	values.Del("page")
+	values.Del("cursor")
+	values.Set(key, value)
+
+	return r.URL.Path + "?" + values.Encode()
 }
 
 // =============================================================================
 
-// Page represents the requested page and rows per page.
+// Page represents the requested page and rows per page. Pages are requested
+// by number, or by a cursor from a previous page. Cursor is nil for pages
+// requested by number.
 type Page struct {
 	Number      int
 	RowsPerPage int
+	Cursor      *Cursor
+}
+
+// Limit returns the number of rows to read for the page. In cursor mode a
+// row more than the page holds is read, to tell if there are more pages.
+func (p Page) Limit() int {
+	if p.Cursor != nil {
+		return p.RowsPerPage + 1
+	}
+	return p.RowsPerPage
 }
 
-// ParseRequest parses the request for the page and rows query string. The
-// defaults are provided as well.
-func ParseRequest(r *http.Request) (Page, error) {
+// ParseRequest parses the request for the page, cursor and rows query
+// string. The defaults are provided as well. A cursor must have been issued
+// for the order the results are requested in. Cursors come from clients, so
+// checkSeek checks the values of the seek before they reach the database.
+func ParseRequest(r *http.Request, orderBy []order.By, checkSeek func(order.Seek, []order.By) error) (Page, error) {
 	values := r.URL.Query()
 
 	number := 1
@@ -57,8 +114,31 @@ func ParseRequest(r *http.Request) (Page, error) {
 		}
 	}
 
+	var cursor *Cursor
+	if token := values.Get("cursor"); token != "" {
+		if values.Has("page") {
+			return Page{}, validate.NewFieldsError("page", errors.New("can't be used with a cursor"))
+		}
+
+		c, err := ParseCursor(token)
+		if err != nil {
+			return Page{}, validate.NewFieldsError("cursor", err)
+		}
+
+		if !slices.Equal(c.OrderBy, orderBy) {
+			return Page{}, validate.NewFieldsError("cursor", errors.New("issued for a different order"))
+		}
+
+		if err := checkSeek(c.Seek, orderBy); err != nil {
+			return Page{}, validate.NewFieldsError("cursor", err)
+		}
+
+		cursor = &c
+	}
+
 	return Page{
 		Number:      number,
 		RowsPerPage: rowsPerPage,
+		Cursor:      cursor,
 	}, nil
 }
@@ -0,0 +1,126 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/shawnzxx/service/business/core/product"
+	"github.com/shawnzxx/service/business/core/user"
+	"github.com/shawnzxx/service/business/web/auth"
+	"github.com/shawnzxx/service/business/web/idempotency"
+	"github.com/shawnzxx/service/business/web/loadshed"
+	"github.com/shawnzxx/service/business/web/ratelimit"
+	"github.com/shawnzxx/service/foundation/web"
+)
+
+// ProblemContentType is the media type of a Problem document.
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix forms the type URI of a problem from its code.
+const problemTypePrefix = "urn:sales-api:problem:"
+
+// Problem is the RFC 7807 form used for API responses from failures in the
+// API. Code is an extension member holding the stable code of the failure,
+// which is also the last part of the type.
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// NewProblem constructs a problem for the code. The status can differ from
+// the default status of the code, since handlers decide what an error means
+// for the request.
+func NewProblem(code ErrorCode, status int, detail string, instance string) Problem {
+	return Problem{
+		Type:     problemTypePrefix + code.Code,
+		Title:    code.Title,
+		Status:   status,
+		Detail:   detail,
+		Instance: instance,
+		Code:     code.Code,
+	}
+}
+
+// =============================================================================
+
+// ErrorCode describes a kind of failure that clients can tell apart by its
+// code instead of matching the message. Codes must not change once they are
+// published.
+type ErrorCode struct {
+	Code   string
+	Status int
+	Title  string
+}
+
+// Set of codes for failures that aren't specific to a domain.
+var (
+	CodeInternal             = ErrorCode{Code: "internal_error", Status: http.StatusInternalServerError, Title: "Internal server error"}
+	CodeValidation           = ErrorCode{Code: "validation_failed", Status: http.StatusBadRequest, Title: "Data validation error"}
+	CodeBodyTooLarge         = ErrorCode{Code: "body_too_large", Status: http.StatusRequestEntityTooLarge, Title: "Request body too large"}
+	CodeUnsupportedMediaType = ErrorCode{Code: "unsupported_media_type", Status: http.StatusUnsupportedMediaType, Title: "Unsupported media type"}
+	CodeRouteNotFound        = ErrorCode{Code: "route_not_found", Status: http.StatusNotFound, Title: "Route not found"}
+	CodeMethodNotAllowed     = ErrorCode{Code: "method_not_allowed", Status: http.StatusMethodNotAllowed, Title: "Method not allowed"}
+	CodeUnauthenticated      = ErrorCode{Code: "unauthenticated", Status: http.StatusUnauthorized, Title: "Authentication required"}
+	CodeForbidden            = ErrorCode{Code: "forbidden", Status: http.StatusForbidden, Title: "Action not allowed"}
+)
+
+// catalogue maps the errors of the business layer to their codes. An error
+// is matched against the entries in order with errors.Is.
+var catalogue = []struct {
+	err  error
+	code ErrorCode
+}{
+	{user.ErrNotFound, ErrorCode{Code: "user_not_found", Status: http.StatusNotFound, Title: "User not found"}},
+	{user.ErrUniqueEmail, ErrorCode{Code: "email_not_unique", Status: http.StatusConflict, Title: "Email is already in use"}},
+	{user.ErrAuthenticationFailure, ErrorCode{Code: "authentication_failed", Status: http.StatusUnauthorized, Title: "Authentication failed"}},
+	{user.ErrVersionConflict, ErrorCode{Code: "user_modified", Status: http.StatusPreconditionFailed, Title: "User has been modified"}},
+	{user.ErrMFAEnabled, ErrorCode{Code: "mfa_already_enabled", Status: http.StatusConflict, Title: "Multi-factor authentication already enabled"}},
+	{user.ErrMFANotEnrolled, ErrorCode{Code: "mfa_not_enrolled", Status: http.StatusBadRequest, Title: "Multi-factor authentication not enrolled"}},
+	{user.ErrMFAInvalidCode, ErrorCode{Code: "mfa_invalid_code", Status: http.StatusBadRequest, Title: "Invalid multi-factor authentication code"}},
+	{product.ErrNotFound, ErrorCode{Code: "product_not_found", Status: http.StatusNotFound, Title: "Product not found"}},
+	{auth.ErrImpersonating, ErrorCode{Code: "impersonation_not_allowed", Status: http.StatusForbidden, Title: "Action not allowed while impersonating"}},
+	{auth.ErrMFAPending, ErrorCode{Code: "mfa_required", Status: http.StatusUnauthorized, Title: "Multi-factor authentication required"}},
+	{auth.ErrForbidden, CodeForbidden},
+	{ratelimit.ErrLimitExceeded, ErrorCode{Code: "rate_limited", Status: http.StatusTooManyRequests, Title: "Rate limit exceeded"}},
+	{idempotency.ErrInFlight, ErrorCode{Code: "idempotency_in_flight", Status: http.StatusConflict, Title: "Request already in progress"}},
+	{idempotency.ErrKeyReused, ErrorCode{Code: "idempotency_key_reused", Status: http.StatusUnprocessableEntity, Title: "Idempotency key reused"}},
+	{loadshed.ErrOverloaded, ErrorCode{Code: "overloaded", Status: http.StatusServiceUnavailable, Title: "Service overloaded"}},
+	{loadshed.ErrDeadlineExceeded, ErrorCode{Code: "deadline_exceeded", Status: http.StatusServiceUnavailable, Title: "Request deadline exceeded"}},
+	{web.ErrBodyTooLarge, CodeBodyTooLarge},
+	{web.ErrUnsupportedMediaType, CodeUnsupportedMediaType},
+	{web.ErrRouteNotFound, CodeRouteNotFound},
+	{web.ErrMethodNotAllowed, CodeMethodNotAllowed},
+}
+
+// LookupCode returns the code of the error from the catalogue, along with
+// the cataloged error it matched.
+func LookupCode(err error) (ErrorCode, error, bool) {
+	for _, entry := range catalogue {
+		if errors.Is(err, entry.err) {
+			return entry.code, entry.err, true
+		}
+	}
+
+	return ErrorCode{}, nil, false
+}
+
+// StatusCode returns a code for a status when an error isn't cataloged,
+// such as "bad_request" for 400.
+func StatusCode(status int) ErrorCode {
+	title := http.StatusText(status)
+	if title == "" {
+		return CodeInternal
+	}
+
+	return ErrorCode{
+		Code:   strings.ReplaceAll(strings.ToLower(title), " ", "_"),
+		Status: status,
+		Title:  title,
+	}
+}
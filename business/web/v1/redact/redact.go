@@ -0,0 +1,252 @@
+// Package redact provides support for removing or masking fields from
+// response values based on the caller's authorization.
+package redact
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/shawnzxx/service/business/web/auth"
+)
+
+// Filter applies the fields selected by an authorization rule to the values
+// sent back to the caller.
+type Filter struct {
+	auth *auth.Auth
+	rule string
+}
+
+// New constructs a Filter that uses the specified redaction rule.
+func New(a *auth.Auth, rule string) *Filter {
+	return &Filter{
+		auth: a,
+		rule: rule,
+	}
+}
+
+// Value returns the json representation of the value, owned by ownerID, with
+// the redactions for the caller applied.
+func (f *Filter) Value(ctx context.Context, ownerID string, v any) (Document, error) {
+	redactions, err := f.auth.Redactions(ctx, auth.GetClaims(ctx), ownerID, f.rule)
+	if err != nil {
+		return Document{}, fmt.Errorf("redactions: ownerID[%s]: %w", ownerID, err)
+	}
+
+	return apply(v, redactions)
+}
+
+// Unowned returns the redactions applied for the caller to the values it
+// doesn't own. Those fields can't be used to filter or order the values
+// either, since the values that come back would give away what's hidden.
+func (f *Filter) Unowned(ctx context.Context) (auth.Redactions, error) {
+	redactions, err := f.auth.Redactions(ctx, auth.GetClaims(ctx), "", f.rule)
+	if err != nil {
+		return nil, fmt.Errorf("redactions: %w", err)
+	}
+
+	return redactions, nil
+}
+
+// Slice returns the json representation of the set of values with the
+// redactions for the caller applied. The owner function identifies who owns
+// each value. The rule is evaluated once per distinct owner.
+func Slice[T any](ctx context.Context, f *Filter, values []T, owner func(T) string) ([]Document, error) {
+	claims := auth.GetClaims(ctx)
+	cache := make(map[string]auth.Redactions)
+
+	docs := make([]Document, len(values))
+	for i, v := range values {
+		ownerID := owner(v)
+
+		redactions, exists := cache[ownerID]
+		if !exists {
+			var err error
+			redactions, err = f.auth.Redactions(ctx, claims, ownerID, f.rule)
+			if err != nil {
+				return nil, fmt.Errorf("redactions: ownerID[%s]: %w", ownerID, err)
+			}
+			cache[ownerID] = redactions
+		}
+
+		doc, err := apply(v, redactions)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = doc
+	}
+
+	return docs, nil
+}
+
+// =============================================================================
+
+// Document is the json representation of a struct value. It keeps the fields
+// in the order they are declared in the struct, and the redactions that were
+// applied to them.
+type Document struct {
+	fields   []field
+	redacted []string
+}
+
+type field struct {
+	name  string
+	value any
+}
+
+// Select returns the document with only the named fields. The document is
+// returned as is when there are no names.
+func (d Document) Select(names []string) Document {
+	if len(names) == 0 {
+		return d
+	}
+
+	selected := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		selected[name] = struct{}{}
+	}
+
+	fields := make([]field, 0, len(names))
+	for _, fld := range d.fields {
+		if _, exists := selected[fld.name]; exists {
+			fields = append(fields, fld)
+		}
+	}
+
+	return Document{fields: fields, redacted: d.redacted}
+}
+
+// With returns the document with a field added at the end, like a related
+// resource embedded in the value.
+func (d Document) With(name string, value any) Document {
+	fields := make([]field, len(d.fields), len(d.fields)+1)
+	copy(fields, d.fields)
+
+	return Document{fields: append(fields, field{name: name, value: value}), redacted: d.redacted}
+}
+
+// Variant identifies the redactions applied to the document, so callers that
+// get different representations of the same value can tell them apart, like
+// in an entity tag. It's empty when nothing was redacted.
+func (d Document) Variant() string {
+	if len(d.redacted) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(d.redacted, ",")))
+	return hex.EncodeToString(sum[:4])
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Document) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	for i, fld := range d.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		name, err := json.Marshal(fld.name)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(fld.value)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", fld.name, err)
+		}
+
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// apply walks the exported fields of the struct and builds the document,
+// removing or masking the fields named in the redactions. Only string values
+// can be masked, any other value marked for masking is removed.
+func apply(v any, redactions auth.Redactions) (Document, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return Document{}, fmt.Errorf("value of type %T is not a struct", v)
+	}
+
+	rt := rv.Type()
+
+	doc := Document{
+		fields: make([]field, 0, rt.NumField()),
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		value := rv.Field(i)
+		if strings.Contains(opts, "omitempty") && value.IsZero() {
+			continue
+		}
+
+		action := redactions[name]
+		if action != "" {
+			doc.redacted = append(doc.redacted, name+"="+action)
+		}
+
+		switch action {
+		case auth.RedactRemove:
+			continue
+
+		case auth.RedactMask:
+			if value.Kind() != reflect.String {
+				continue
+			}
+			doc.fields = append(doc.fields, field{name: name, value: mask(value.String())})
+
+		default:
+			doc.fields = append(doc.fields, field{name: name, value: value.Interface()})
+		}
+	}
+
+	return doc, nil
+}
+
+// mask hides all but the first character of the value. For email addresses
+// the domain is kept as well.
+func mask(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	local, domain, isEmail := strings.Cut(s, "@")
+	if !isEmail {
+		local = s
+	}
+
+	masked := "***"
+	if r := []rune(local); len(r) > 0 {
+		masked = string(r[:1]) + masked
+	}
+	if isEmail {
+		masked += "@" + domain
+	}
+
+	return masked
+}
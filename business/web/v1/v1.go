@@ -30,6 +30,11 @@ func (re *RequestError) Error() string {
 	return re.Err.Error()
 }
 
+// Unwrap returns the wrapped error.
+func (re *RequestError) Unwrap() error {
+	return re.Err
+}
+
 // IsRequestError checks if an error of type RequestError exists.
 func IsRequestError(err error) bool {
 	var re *RequestError
@@ -0,0 +1,302 @@
+// Package openapi provides support for describing the routes of an API and
+// building an OpenAPI 3 document from the descriptions. The schemas of the
+// request and response bodies are generated from the Go models.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of the OpenAPI specification documents conform to.
+const Version = "3.0.3"
+
+// Operation describes a route of the API.
+//
+// Path uses the syntax of the router, like /users/:user_id, and its
+// parameters are described as strings. Request and Response are values of
+// the models of the bodies, nil when there is no body. Streams lists the
+// content types the response can also be streamed as. Rule is the
+// authorization rule of the route, added to the document as the
+// x-auth-rule extension.
+type Operation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	Security    string
+	Rule        string
+	Params      []Param
+	Request     any
+	Status      int
+	Response    any
+	Streams     []string
+}
+
+// OneOf is used in place of a model when a body can take the form of any
+// of the models.
+type OneOf []any
+
+// Param describes a query or header parameter of an operation.
+type Param struct {
+	Name        string
+	In          string
+	Description string
+	Type        string
+	Format      string
+	Enum        []string
+	Required    bool
+}
+
+// Query constructs a string query parameter.
+func Query(name string, description string) Param {
+	return Param{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Type:        "string",
+	}
+}
+
+// Header constructs a string header parameter.
+func Header(name string, description string) Param {
+	return Param{
+		Name:        name,
+		In:          "header",
+		Description: description,
+		Type:        "string",
+	}
+}
+
+// SecurityScheme describes how clients authenticate.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// =============================================================================
+
+// Spec collects the operations of an API to build its document.
+type Spec struct {
+	title      string
+	version    string
+	operations []Operation
+	security   map[string]SecurityScheme
+	errors     map[string]any
+}
+
+// New constructs a spec for the API with the title and version.
+func New(title string, version string) *Spec {
+	return &Spec{
+		title:    title,
+		version:  version,
+		security: make(map[string]SecurityScheme),
+		errors:   make(map[string]any),
+	}
+}
+
+// AddSecurity adds a security scheme operations can refer to by name.
+func (s *Spec) AddSecurity(name string, scheme SecurityScheme) {
+	s.security[name] = scheme
+}
+
+// SetErrors sets the models of the error responses by content type. Every
+// operation describes them as its default response.
+func (s *Spec) SetErrors(models map[string]any) {
+	s.errors = models
+}
+
+// Add adds the operations to the spec.
+func (s *Spec) Add(ops ...Operation) {
+	s.operations = append(s.operations, ops...)
+}
+
+// Operations returns the operations of the spec.
+func (s *Spec) Operations() []Operation {
+	return append([]Operation{}, s.operations...)
+}
+
+// Document builds the OpenAPI document for the operations.
+func (s *Spec) Document() (Document, error) {
+	schemas := newSchemas()
+
+	errors := make(map[string]MediaType, len(s.errors))
+	for contentType, model := range s.errors {
+		errors[contentType] = MediaType{Schema: schemas.of(model)}
+	}
+
+	doc := Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:   s.title,
+			Version: s.version,
+		},
+		Paths: make(map[string]map[string]*OperationObject),
+	}
+
+	seen := make(map[string]bool)
+	for _, op := range s.operations {
+		key := op.Method + " " + op.Path
+		if seen[key] {
+			return Document{}, fmt.Errorf("operation %q described twice", key)
+		}
+		seen[key] = true
+
+		if op.Security != "" {
+			if _, exists := s.security[op.Security]; !exists {
+				return Document{}, fmt.Errorf("operation %q: unknown security scheme %q", key, op.Security)
+			}
+		}
+
+		path, params := pathParams(op.Path)
+		item, exists := doc.Paths[path]
+		if !exists {
+			item = make(map[string]*OperationObject)
+			doc.Paths[path] = item
+		}
+
+		item[strings.ToLower(op.Method)] = s.operation(op, params, errors, schemas)
+	}
+
+	doc.Components = Components{
+		Schemas:         schemas.components,
+		SecuritySchemes: s.security,
+	}
+
+	return doc, nil
+}
+
+// operation converts the description of the operation into its object.
+func (s *Spec) operation(op Operation, pathParams []string, errors map[string]MediaType, schemas *schemas) *OperationObject {
+	obj := OperationObject{
+		OperationID: operationID(op),
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Responses:   make(map[string]Response),
+		AuthRule:    op.Rule,
+	}
+
+	for _, name := range pathParams {
+		obj.Parameters = append(obj.Parameters, ParameterObject{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+
+	for _, p := range op.Params {
+		schema := Schema{Type: p.Type, Format: p.Format, Enum: p.Enum}
+		if schema.Type == "" {
+			schema.Type = "string"
+		}
+
+		obj.Parameters = append(obj.Parameters, ParameterObject{
+			Name:        p.Name,
+			In:          p.In,
+			Description: p.Description,
+			Required:    p.Required,
+			Schema:      &schema,
+		})
+	}
+
+	if op.Security != "" {
+		obj.Security = []map[string][]string{{op.Security: {}}}
+	}
+
+	if op.Request != nil {
+		obj.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/json": {Schema: schemas.of(op.Request)},
+			},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	resp := Response{Description: http.StatusText(status)}
+	if op.Response != nil || len(op.Streams) > 0 {
+		resp.Content = make(map[string]MediaType)
+	}
+	if op.Response != nil {
+		resp.Content["application/json"] = MediaType{Schema: schemas.of(op.Response)}
+	}
+	for _, contentType := range op.Streams {
+		resp.Content[contentType] = MediaType{Schema: &Schema{Type: "string"}}
+	}
+	obj.Responses[strconv.Itoa(status)] = resp
+
+	if len(errors) > 0 {
+		obj.Responses["default"] = Response{
+			Description: "Error",
+			Content:     errors,
+		}
+	}
+
+	return &obj
+}
+
+// =============================================================================
+
+// routeParam matches a parameter in a path using the syntax of the router.
+var routeParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// pathParams converts the path into the syntax of the document and returns
+// the names of its parameters.
+func pathParams(path string) (string, []string) {
+	var names []string
+	path = routeParam.ReplaceAllStringFunc(path, func(s string) string {
+		names = append(names, s[1:])
+		return "{" + s[1:] + "}"
+	})
+
+	return path, names
+}
+
+// operationID constructs an id for the operation from its method and path,
+// like getUsersByUserId for GET /users/:user_id.
+func operationID(op Operation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool { return r == '/' }) {
+		if name, found := strings.CutPrefix(part, ":"); found {
+			b.WriteString("By")
+			part = name
+		}
+
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+
+	return b.String()
+}
+
+// Routes returns the method and path of each operation of the document in
+// the syntax of the router, sorted. It's used to compare a document with
+// the routes of a mux.
+func (d Document) Routes() []string {
+	var routes []string
+	for path, item := range d.Paths {
+		path = strings.NewReplacer("{", ":", "}", "").Replace(path)
+		for method := range item {
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(routes)
+
+	return routes
+}
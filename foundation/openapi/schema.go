@@ -0,0 +1,199 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// schemas generates the schemas of Go models. Named struct types become
+// components that are referenced, so a model used by several operations is
+// described once.
+type schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{
+		components: make(map[string]*Schema),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// of returns the schema of the value's type.
+func (s *schemas) of(v any) *Schema {
+	if models, ok := v.(OneOf); ok {
+		schema := Schema{OneOf: make([]*Schema, len(models))}
+		for i, model := range models {
+			schema.OneOf[i] = s.of(model)
+		}
+		return &schema
+	}
+
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *schemas) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.schema(t.Elem())
+		if schema.Ref != "" {
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+
+	case reflect.String:
+		return &Schema{Type: "string"}
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return s.ref(t)
+	}
+
+	// Interfaces and anything else can hold any value.
+	return &Schema{}
+}
+
+// ref returns a reference to the component of the named struct type,
+// generating the component the first time.
+func (s *schemas) ref(t reflect.Type) *Schema {
+	name, exists := s.names[t]
+	if !exists {
+		base := componentName(t)
+		name = base
+		for i := 2; s.components[name] != nil; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		s.names[t] = name
+
+		// The component is reserved before the fields are described, so
+		// recursive types refer to themselves.
+		s.components[name] = &Schema{}
+		*s.components[name] = *s.object(t)
+	}
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// object describes the fields of the struct type, following the rules of
+// the encoding/json package for names and embedded structs. A field is
+// required when its validate tag says so.
+func (s *schemas) object(t reflect.Type) *Schema {
+	schema := Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := s.object(field.Type)
+			for prop, ps := range embedded.Properties {
+				schema.Properties[prop] = ps
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = s.schema(field.Type)
+
+		if !strings.Contains(opts, "omitempty") && hasRule(field.Tag.Get("validate"), "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return &schema
+}
+
+// hasRule reports if the validate tag contains the rule.
+func hasRule(tag string, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if r == rule {
+			return true
+		}
+	}
+
+	return false
+}
+
+// packagePath matches the package paths in the name of a generic type, like
+// Response[github.com/org/service/usergrp.AppUser].
+var packagePath = regexp.MustCompile(`[\w./-]*/`)
+
+// componentName returns the name of the type's component. The names of the
+// type arguments of a generic type are kept without their package, so
+// paging.Response[usergrp.AppUser] becomes Response_AppUser.
+func componentName(t reflect.Type) string {
+	name := packagePath.ReplaceAllString(t.Name(), "")
+
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '[' || r == ']' || r == ',' || r == ' ' || r == '*' }) {
+		if b.Len() > 0 {
+			b.WriteString("_")
+		}
+		if _, after, found := strings.Cut(part, "."); found {
+			part = after
+		}
+		b.WriteString(part)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,338 @@
+// Package otlp provides an OpenTelemetry span exporter that sends traces to a
+// collector using the OTLP/HTTP protocol with JSON encoding.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Config represents the information required to construct an exporter.
+type Config struct {
+	Endpoint string
+	Headers  map[string]string
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+// Exporter implements the sdktrace.SpanExporter interface and posts spans to
+// the /v1/traces endpoint of an OTLP collector.
+type Exporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu       sync.Mutex
+	shutdown bool
+}
+
+// New constructs an exporter for the specified collector endpoint. The
+// endpoint is the base url of the collector, like http://localhost:4318.
+func New(cfg Config) (*Exporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint is required")
+	}
+
+	client := cfg.Client
+	if client == nil {
+		timeout := cfg.Timeout
+		if timeout == 0 {
+			timeout = 10 * time.Second
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+
+	exp := Exporter{
+		url:     strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/traces",
+		headers: cfg.Headers,
+		client:  client,
+	}
+
+	return &exp, nil
+}
+
+// ExportSpans sends the batch of spans to the collector.
+func (exp *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	exp.mu.Lock()
+	shutdown := exp.shutdown
+	exp.mu.Unlock()
+
+	if shutdown || len(spans) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(toRequest(spans))
+	if err != nil {
+		return fmt.Errorf("encoding spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, exp.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range exp.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := exp.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending spans: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector responded with status %d: %s", resp.StatusCode, body)
+	}
+
+	io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
+
+// Shutdown stops the exporter from sending any more spans.
+func (exp *Exporter) Shutdown(ctx context.Context) error {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+
+	exp.shutdown = true
+
+	return nil
+}
+
+// =============================================================================
+
+// The types below mirror the JSON mapping of the OTLP protobuf messages.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Events            []event    `json:"events,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type event struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string     `json:"stringValue,omitempty"`
+	BoolValue   *bool       `json:"boolValue,omitempty"`
+	IntValue    *string     `json:"intValue,omitempty"`
+	DoubleValue *float64    `json:"doubleValue,omitempty"`
+	ArrayValue  *arrayValue `json:"arrayValue,omitempty"`
+}
+
+type arrayValue struct {
+	Values []anyValue `json:"values"`
+}
+
+// =============================================================================
+
+// toRequest groups the spans by resource and instrumentation scope.
+func toRequest(spans []sdktrace.ReadOnlySpan) exportRequest {
+	type scopeKey struct {
+		name    string
+		version string
+	}
+
+	var req exportRequest
+	resIdx := make(map[attribute.Distinct]int)
+	scopeIdx := make(map[attribute.Distinct]map[scopeKey]int)
+
+	for _, s := range spans {
+		res := s.Resource()
+		rk := res.Equivalent()
+
+		ri, exists := resIdx[rk]
+		if !exists {
+			ri = len(req.ResourceSpans)
+			resIdx[rk] = ri
+			scopeIdx[rk] = make(map[scopeKey]int)
+			req.ResourceSpans = append(req.ResourceSpans, resourceSpans{
+				Resource: resource{Attributes: toKeyValues(res.Attributes())},
+			})
+		}
+
+		is := s.InstrumentationScope()
+		sk := scopeKey{name: is.Name, version: is.Version}
+
+		si, exists := scopeIdx[rk][sk]
+		if !exists {
+			si = len(req.ResourceSpans[ri].ScopeSpans)
+			scopeIdx[rk][sk] = si
+			req.ResourceSpans[ri].ScopeSpans = append(req.ResourceSpans[ri].ScopeSpans, scopeSpans{
+				Scope: scope{Name: is.Name, Version: is.Version},
+			})
+		}
+
+		ss := &req.ResourceSpans[ri].ScopeSpans[si]
+		ss.Spans = append(ss.Spans, toSpan(s))
+	}
+
+	return req
+}
+
+func toSpan(s sdktrace.ReadOnlySpan) span {
+	sp := span{
+		TraceID:           s.SpanContext().TraceID().String(),
+		SpanID:            s.SpanContext().SpanID().String(),
+		Name:              s.Name(),
+		Kind:              int(s.SpanKind()),
+		StartTimeUnixNano: unixNano(s.StartTime()),
+		EndTimeUnixNano:   unixNano(s.EndTime()),
+		Attributes:        toKeyValues(s.Attributes()),
+		Status:            toStatus(s.Status()),
+	}
+
+	if s.Parent().HasSpanID() {
+		sp.ParentSpanID = s.Parent().SpanID().String()
+	}
+
+	for _, e := range s.Events() {
+		sp.Events = append(sp.Events, event{
+			TimeUnixNano: unixNano(e.Time),
+			Name:         e.Name,
+			Attributes:   toKeyValues(e.Attributes),
+		})
+	}
+
+	return sp
+}
+
+// toStatus maps the OpenTelemetry status codes onto the OTLP ones, which
+// use a different ordering.
+func toStatus(s sdktrace.Status) status {
+	switch s.Code {
+	case codes.Ok:
+		return status{Code: 1, Message: s.Description}
+	case codes.Error:
+		return status{Code: 2, Message: s.Description}
+	default:
+		return status{Code: 0}
+	}
+}
+
+func toKeyValues(attrs []attribute.KeyValue) []keyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	kvs := make([]keyValue, len(attrs))
+	for i, attr := range attrs {
+		kvs[i] = keyValue{Key: string(attr.Key), Value: toAnyValue(attr.Value)}
+	}
+
+	return kvs
+}
+
+func toAnyValue(v attribute.Value) anyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		b := v.AsBool()
+		return anyValue{BoolValue: &b}
+
+	case attribute.INT64:
+		i := strconv.FormatInt(v.AsInt64(), 10)
+		return anyValue{IntValue: &i}
+
+	case attribute.FLOAT64:
+		f := v.AsFloat64()
+		return anyValue{DoubleValue: &f}
+
+	case attribute.BOOLSLICE:
+		var values []anyValue
+		for _, b := range v.AsBoolSlice() {
+			values = append(values, toAnyValue(attribute.BoolValue(b)))
+		}
+		return anyValue{ArrayValue: &arrayValue{Values: values}}
+
+	case attribute.INT64SLICE:
+		var values []anyValue
+		for _, i := range v.AsInt64Slice() {
+			values = append(values, toAnyValue(attribute.Int64Value(i)))
+		}
+		return anyValue{ArrayValue: &arrayValue{Values: values}}
+
+	case attribute.FLOAT64SLICE:
+		var values []anyValue
+		for _, f := range v.AsFloat64Slice() {
+			values = append(values, toAnyValue(attribute.Float64Value(f)))
+		}
+		return anyValue{ArrayValue: &arrayValue{Values: values}}
+
+	case attribute.STRINGSLICE:
+		var values []anyValue
+		for _, s := range v.AsStringSlice() {
+			values = append(values, toAnyValue(attribute.StringValue(s)))
+		}
+		return anyValue{ArrayValue: &arrayValue{Values: values}}
+
+	default:
+		s := v.Emit()
+		return anyValue{StringValue: &s}
+	}
+}
+
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
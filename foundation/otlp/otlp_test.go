@@ -0,0 +1,312 @@
+package otlp_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shawnzxx/service/foundation/otlp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// request is the part of the OTLP/JSON export request the tests read back.
+type request struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []keyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Scope struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"scope"`
+			Spans []struct {
+				TraceID           string     `json:"traceId"`
+				SpanID            string     `json:"spanId"`
+				ParentSpanID      string     `json:"parentSpanId"`
+				Name              string     `json:"name"`
+				Kind              int        `json:"kind"`
+				StartTimeUnixNano string     `json:"startTimeUnixNano"`
+				EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+				Attributes        []keyValue `json:"attributes"`
+				Status            struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type keyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// collector records the requests posted to it.
+type collector struct {
+	*httptest.Server
+	status  int
+	path    string
+	header  http.Header
+	bodies  [][]byte
+	request request
+}
+
+func newCollector(t *testing.T, status int) *collector {
+	c := collector{status: status}
+
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Should be able to read the request: %s", err)
+		}
+
+		c.path = r.URL.Path
+		c.header = r.Header
+		c.bodies = append(c.bodies, body)
+
+		if err := json.Unmarshal(body, &c.request); err != nil {
+			t.Errorf("Should be able to decode the request: %s", err)
+		}
+
+		w.WriteHeader(c.status)
+	}))
+	t.Cleanup(c.Close)
+
+	return &c
+}
+
+var (
+	traceID = trace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	spanID  = trace.SpanID{0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8}
+	childID = trace.SpanID{0xb1, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8}
+)
+
+func spanContext(id trace.SpanID) trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     id,
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+// TestExportSpans checks the spans are posted as OTLP/JSON, grouped by
+// resource and scope, with the values in the form the mapping requires.
+func TestExportSpans(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+
+	exp, err := otlp.New(otlp.Config{
+		Endpoint: c.URL + "/",
+		Headers:  map[string]string{"Authorization": "Bearer key"},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the exporter: %s", err)
+	}
+
+	sales := resource.NewSchemaless(attribute.String("service.name", "sales-api"))
+	metrics := resource.NewSchemaless(attribute.String("service.name", "metrics"))
+	web := instrumentation.Library{Name: "web", Version: "1.0"}
+	db := instrumentation.Library{Name: "database"}
+	start := time.Unix(1700000000, 5)
+
+	stubs := tracetest.SpanStubs{
+		{
+			Name:                   "request",
+			SpanContext:            spanContext(spanID),
+			SpanKind:               trace.SpanKindServer,
+			StartTime:              start,
+			EndTime:                start.Add(time.Second),
+			Attributes:             []attribute.KeyValue{attribute.Int("http.status_code", 500), attribute.Bool("retry", true), attribute.StringSlice("roles", []string{"ADMIN"})},
+			Status:                 sdktrace.Status{Code: codes.Error, Description: "boom"},
+			Resource:               sales,
+			InstrumentationLibrary: web,
+		},
+		{
+			Name:                   "query",
+			SpanContext:            spanContext(childID),
+			Parent:                 spanContext(spanID),
+			Status:                 sdktrace.Status{Code: codes.Ok},
+			Resource:               sales,
+			InstrumentationLibrary: db,
+		},
+		{
+			Name:                   "collect",
+			SpanContext:            spanContext(childID),
+			Resource:               metrics,
+			InstrumentationLibrary: web,
+		},
+		{
+			Name:                   "respond",
+			SpanContext:            spanContext(childID),
+			Parent:                 spanContext(spanID),
+			Resource:               sales,
+			InstrumentationLibrary: web,
+		},
+	}
+
+	if err := exp.ExportSpans(context.Background(), stubs.Snapshots()); err != nil {
+		t.Fatalf("Should be able to export the spans: %s", err)
+	}
+
+	if c.path != "/v1/traces" {
+		t.Errorf("Should post to /v1/traces, got %q.", c.path)
+	}
+
+	if ct := c.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Should post JSON, got %q.", ct)
+	}
+
+	if auth := c.header.Get("Authorization"); auth != "Bearer key" {
+		t.Errorf("Should send the configured headers, got %q.", auth)
+	}
+
+	rs := c.request.ResourceSpans
+	if len(rs) != 2 {
+		t.Fatalf("Should group the spans into 2 resources, got %d.", len(rs))
+	}
+
+	if attrs := rs[0].Resource.Attributes; len(attrs) != 1 || attrs[0].Value["stringValue"] != "sales-api" {
+		t.Errorf("Should describe the resource of the first span, got %v.", attrs)
+	}
+
+	if len(rs[0].ScopeSpans) != 2 || len(rs[1].ScopeSpans) != 1 {
+		t.Fatalf("Should group the spans of each resource by scope, got %d and %d.", len(rs[0].ScopeSpans), len(rs[1].ScopeSpans))
+	}
+
+	ws := rs[0].ScopeSpans[0]
+	if ws.Scope.Name != "web" || ws.Scope.Version != "1.0" || len(ws.Spans) != 2 {
+		t.Errorf("Should keep the spans of a scope together, got %s %s with %d spans.", ws.Scope.Name, ws.Scope.Version, len(ws.Spans))
+	}
+
+	if ds := rs[0].ScopeSpans[1]; ds.Scope.Name != "database" || len(ds.Spans) != 1 {
+		t.Errorf("Should put the database span in its own scope, got %s with %d spans.", ds.Scope.Name, len(ds.Spans))
+	}
+
+	req := ws.Spans[0]
+
+	if req.TraceID != "0102030405060708090a0b0c0d0e0f10" {
+		t.Errorf("Should encode the trace id as hex, got %q.", req.TraceID)
+	}
+
+	if req.SpanID != "a1a2a3a4a5a6a7a8" {
+		t.Errorf("Should encode the span id as hex, got %q.", req.SpanID)
+	}
+
+	if req.ParentSpanID != "" {
+		t.Errorf("Should leave out the parent of a root span, got %q.", req.ParentSpanID)
+	}
+
+	if child := ws.Spans[1]; child.ParentSpanID != "a1a2a3a4a5a6a7a8" {
+		t.Errorf("Should encode the parent span id as hex, got %q.", child.ParentSpanID)
+	}
+
+	if req.Kind != int(trace.SpanKindServer) {
+		t.Errorf("Should keep the span kind, got %d.", req.Kind)
+	}
+
+	if req.StartTimeUnixNano != "1700000000000000005" || req.EndTimeUnixNano != "1700000001000000005" {
+		t.Errorf("Should encode the times as strings of nanoseconds, got %q and %q.", req.StartTimeUnixNano, req.EndTimeUnixNano)
+	}
+
+	if ws.Spans[1].StartTimeUnixNano != "0" {
+		t.Errorf("Should encode a missing time as 0, got %q.", ws.Spans[1].StartTimeUnixNano)
+	}
+
+	attrs := make(map[string]map[string]any)
+	for _, kv := range req.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+
+	if v, ok := attrs["http.status_code"]["intValue"].(string); !ok || v != "500" {
+		t.Errorf("Should encode an int as a string, got %#v.", attrs["http.status_code"])
+	}
+
+	if v, ok := attrs["retry"]["boolValue"].(bool); !ok || !v {
+		t.Errorf("Should encode a bool as a bool, got %#v.", attrs["retry"])
+	}
+
+	values, _ := attrs["roles"]["arrayValue"].(map[string]any)["values"].([]any)
+	if len(values) != 1 || values[0].(map[string]any)["stringValue"] != "ADMIN" {
+		t.Errorf("Should encode a slice as an array of values, got %#v.", attrs["roles"])
+	}
+}
+
+// TestExportStatus checks the OpenTelemetry status codes are remapped onto
+// the OTLP ones, which are ordered differently.
+func TestExportStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  sdktrace.Status
+		code    int
+		message string
+	}{
+		{name: "unset", status: sdktrace.Status{Code: codes.Unset}, code: 0},
+		{name: "ok", status: sdktrace.Status{Code: codes.Ok}, code: 1},
+		{name: "error", status: sdktrace.Status{Code: codes.Error, Description: "boom"}, code: 2, message: "boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCollector(t, http.StatusOK)
+
+			exp, err := otlp.New(otlp.Config{Endpoint: c.URL})
+			if err != nil {
+				t.Fatalf("Should be able to construct the exporter: %s", err)
+			}
+
+			stubs := tracetest.SpanStubs{{Name: tt.name, SpanContext: spanContext(spanID), Status: tt.status}}
+			if err := exp.ExportSpans(context.Background(), stubs.Snapshots()); err != nil {
+				t.Fatalf("Should be able to export the span: %s", err)
+			}
+
+			st := c.request.ResourceSpans[0].ScopeSpans[0].Spans[0].Status
+			if st.Code != tt.code || st.Message != tt.message {
+				t.Errorf("Should get the status %d %q, got %d %q.", tt.code, tt.message, st.Code, st.Message)
+			}
+		})
+	}
+}
+
+// TestExportFailures checks a collector error is returned, and nothing is
+// sent once the exporter is shut down.
+func TestExportFailures(t *testing.T) {
+	c := newCollector(t, http.StatusBadRequest)
+
+	exp, err := otlp.New(otlp.Config{Endpoint: c.URL})
+	if err != nil {
+		t.Fatalf("Should be able to construct the exporter: %s", err)
+	}
+
+	stubs := tracetest.SpanStubs{{Name: "request", SpanContext: spanContext(spanID)}}
+
+	if err := exp.ExportSpans(context.Background(), stubs.Snapshots()); err == nil {
+		t.Errorf("Should fail when the collector rejects the spans.")
+	}
+
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Should be able to shut down the exporter: %s", err)
+	}
+
+	if err := exp.ExportSpans(context.Background(), stubs.Snapshots()); err != nil {
+		t.Errorf("Should drop spans after shutdown: %s", err)
+	}
+
+	if len(c.bodies) != 1 {
+		t.Errorf("Should not post spans after shutdown, got %d requests.", len(c.bodies))
+	}
+
+	if _, err := otlp.New(otlp.Config{}); err == nil {
+		t.Errorf("Should require an endpoint.")
+	}
+}
@@ -0,0 +1,150 @@
+// Package shutdown provides support for shutting down a service in phases,
+// so traffic stops arriving before the requests in flight are drained and
+// the resources they use are released.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Config represents information required to construct a coordinator.
+//
+// PreStopDelay is how long to wait after readiness starts failing, giving
+// load balancers time to stop sending traffic. Timeout is the time the
+// phases have to complete once the delay is over. PhaseTimeout is the least
+// time each phase gets, even when the phases before it used up the Timeout,
+// so a slow drain doesn't keep the later phases from releasing resources.
+type Config struct {
+	Log          *zap.SugaredLogger
+	PreStopDelay time.Duration
+	Timeout      time.Duration
+	PhaseTimeout time.Duration
+}
+
+// phase is a step of the shutdown.
+type phase struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Coordinator runs the phases of the shutdown in the reverse order they were
+// added, like deferred calls. A phase is added when the resource it releases
+// is started, so what was started last is stopped first.
+type Coordinator struct {
+	log          *zap.SugaredLogger
+	preStopDelay time.Duration
+	timeout      time.Duration
+	phaseTimeout time.Duration
+
+	mu       sync.Mutex
+	phases   []phase
+	draining chan struct{}
+	once     sync.Once
+}
+
+// New constructs a coordinator.
+func New(cfg Config) *Coordinator {
+	return &Coordinator{
+		log:          cfg.Log,
+		preStopDelay: cfg.PreStopDelay,
+		timeout:      cfg.Timeout,
+		phaseTimeout: cfg.PhaseTimeout,
+		draining:     make(chan struct{}),
+	}
+}
+
+// Add adds a phase to run before the phases already added. A phase should
+// stop when the context is done.
+func (c *Coordinator) Add(name string, fn func(ctx context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.phases = append(c.phases, phase{name: name, fn: fn})
+}
+
+// Draining returns a channel that is closed when the shutdown starts. The
+// readiness check fails from then on, and long lived requests like streams
+// use it to end early.
+func (c *Coordinator) Draining() <-chan struct{} {
+	return c.draining
+}
+
+// Shutdown fails readiness, waits the pre-stop delay and then runs the
+// phases. It's used when the service is asked to stop.
+func (c *Coordinator) Shutdown() error {
+	c.startDraining()
+
+	if c.preStopDelay > 0 {
+		c.log.Infow("shutdown", "status", "waiting pre-stop delay", "delay", c.preStopDelay)
+		time.Sleep(c.preStopDelay)
+	}
+
+	return c.run()
+}
+
+// Stop fails readiness and runs the phases straight away. It's used when
+// the service is stopping because it failed, and traffic isn't expected.
+// Phases only run once, so Stop can be deferred to release what was started
+// when the service fails to start.
+func (c *Coordinator) Stop() error {
+	c.startDraining()
+
+	return c.run()
+}
+
+// startDraining closes the draining channel, once.
+func (c *Coordinator) startDraining() {
+	c.once.Do(func() {
+		c.log.Infow("shutdown", "status", "readiness failing")
+		close(c.draining)
+	})
+}
+
+// run runs the phases that haven't run yet. A phase that fails doesn't stop
+// the phases after it, so resources are still released. Each phase has its
+// own deadline: what is left of the timeout, or the phase timeout when less
+// is left. The errors are returned.
+func (c *Coordinator) run() error {
+	c.mu.Lock()
+	phases := c.phases
+	c.phases = nil
+	c.mu.Unlock()
+
+	deadline := time.Now().Add(c.timeout)
+
+	var errs []error
+	for i := len(phases) - 1; i >= 0; i-- {
+		p := phases[i]
+
+		c.log.Infow("shutdown", "status", "phase started", "phase", p.name)
+		start := time.Now()
+
+		ctx, cancel := context.WithDeadline(context.Background(), later(deadline, start.Add(c.phaseTimeout)))
+		err := p.fn(ctx)
+		cancel()
+
+		if err != nil {
+			c.log.Errorw("shutdown", "status", "phase failed", "phase", p.name, "duration", time.Since(start), "ERROR", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+			continue
+		}
+
+		c.log.Infow("shutdown", "status", "phase complete", "phase", p.name, "duration", time.Since(start))
+	}
+
+	return errors.Join(errs...)
+}
+
+// later returns the later of the two times.
+func later(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,268 @@
+// Package tlsconfig provides support for serving TLS with certificates that
+// are rotated on disk, and for verifying client certificates.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Set of client authentication modes.
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+var clientAuths = map[string]tls.ClientAuthType{
+	ClientAuthNone:     tls.NoClientCert,
+	ClientAuthOptional: tls.VerifyClientCertIfGiven,
+	ClientAuthRequire:  tls.RequireAndVerifyClientCert,
+}
+
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Config represents information required to construct a TLS configuration.
+//
+// The certificate, key and client CA files are checked for changes at most
+// once per ReloadInterval, when a client connects, and are loaded again
+// when they change. ClientAuth is one of none, optional or require. A
+// client certificate is verified against the CA bundle in ClientCAFile.
+//
+// MinVersion is 1.2 or 1.3. CipherSuites are the names of the suites used
+// with TLS 1.2, like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. The suites of
+// TLS 1.3 aren't configurable. Go's defaults are used when it's empty.
+type Config struct {
+	Log            *zap.SugaredLogger
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	ClientAuth     string
+	MinVersion     string
+	CipherSuites   []string
+	ReloadInterval time.Duration
+}
+
+// New constructs a TLS configuration for a server. The files are loaded
+// once before it returns, so a missing or invalid file fails at startup.
+func New(cfg Config) (*tls.Config, error) {
+	if cfg.ClientAuth == "" {
+		cfg.ClientAuth = ClientAuthNone
+	}
+
+	clientAuth, exists := clientAuths[cfg.ClientAuth]
+	if !exists {
+		return nil, fmt.Errorf("unknown client auth %q", cfg.ClientAuth)
+	}
+
+	if clientAuth != tls.NoClientCert && cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("client auth %q requires a client CA file", cfg.ClientAuth)
+	}
+
+	if cfg.MinVersion == "" {
+		cfg.MinVersion = "1.2"
+	}
+
+	minVersion, exists := versions[cfg.MinVersion]
+	if !exists {
+		return nil, fmt.Errorf("unsupported minimum version %q", cfg.MinVersion)
+	}
+
+	suites, err := cipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	r := reloader{
+		log:      cfg.Log,
+		certFile: cfg.CertFile,
+		keyFile:  cfg.KeyFile,
+		caFile:   cfg.ClientCAFile,
+		interval: cfg.ReloadInterval,
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.checked = time.Now()
+
+	base := tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+		ClientAuth:     clientAuth,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: r.certificate,
+	}
+
+	// The client CA pool can't be swapped on a tls.Config in use, so each
+	// handshake gets a copy of the configuration with the current pool.
+	if cfg.ClientCAFile != "" {
+		base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := base.Clone()
+			c.GetConfigForClient = nil
+			c.ClientCAs = r.clientCAs()
+			return c, nil
+		}
+	}
+
+	return &base, nil
+}
+
+// cipherSuites converts the names of the cipher suites into their ids. Only
+// the suites Go considers secure are accepted.
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, len(names))
+	for i, name := range names {
+		id, exists := secure[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+// =============================================================================
+
+// reloader holds the certificate and client CA pool loaded from the files
+// and loads them again when the files change.
+type reloader struct {
+	log      *zap.SugaredLogger
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	stamps  []string
+	checked time.Time
+}
+
+// certificate returns the current certificate.
+func (r *reloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.reloadIfChanged()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cert, nil
+}
+
+// clientCAs returns the current client CA pool.
+func (r *reloader) clientCAs() *x509.CertPool {
+	r.reloadIfChanged()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.pool
+}
+
+// reloadIfChanged loads the files again when the interval has passed since
+// they were last checked and they changed. The files in use are kept when
+// the new ones can't be loaded, like in the middle of a rotation.
+func (r *reloader) reloadIfChanged() {
+	r.mu.Lock()
+	if time.Since(r.checked) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.checked = time.Now()
+	stamps := r.stamps
+	r.mu.Unlock()
+
+	current, err := r.stat()
+	if err != nil {
+		r.log.Errorw("tls", "status", "checking certificate files", "ERROR", err)
+		return
+	}
+
+	if slices.Equal(stamps, current) {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		r.log.Errorw("tls", "status", "reloading certificate files", "ERROR", err)
+		return
+	}
+
+	r.log.Infow("tls", "status", "certificate files reloaded", "cert", r.certFile)
+}
+
+// load loads the certificate, key and client CA files.
+func (r *reloader) load() error {
+	stamps, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("reading client CA file: %w", err)
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("client CA file contains no certificates")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.pool = pool
+	r.stamps = stamps
+
+	return nil
+}
+
+// stat returns the modification time and size of each file, which change
+// when the file is replaced.
+func (r *reloader) stat() ([]string, error) {
+	var stamps []string
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("stat: %w", err)
+		}
+
+		stamps = append(stamps, fmt.Sprintf("%s:%d:%d", file, info.ModTime().UnixNano(), info.Size()))
+	}
+
+	return stamps, nil
+}
@@ -0,0 +1,115 @@
+// Package totp implements time-based one-time passwords as described in
+// RFC 6238, using the defaults supported by common authenticator apps:
+// HMAC-SHA1, six digits and a thirty second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Set of values used to generate codes.
+const (
+	Digits = 6
+	Period = 30 * time.Second
+)
+
+// secretSize is the number of random bytes in a secret, as recommended by
+// RFC 4226 for HMAC-SHA1.
+const secretSize = 20
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret encoded in base32.
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("reading random bytes: %w", err)
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// URI returns the otpauth provisioning URI for the secret. Authenticator apps
+// read it from a QR code to enroll the account.
+func URI(issuer string, account string, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+
+	q := make(url.Values)
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(Digits))
+	q.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// Code returns the code for the secret at the specified time.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("decoding secret: %w", err)
+	}
+
+	return otp(key, uint64(t.Unix()/int64(Period.Seconds()))), nil
+}
+
+// Validate reports whether the code is valid for the secret at the specified
+// time and returns the time step the code belongs to. Codes from the adjacent
+// periods are accepted to allow for clock drift between the server and the
+// device. Codes from steps at or before the last step accepted are rejected,
+// so a code can't be used twice.
+func Validate(secret string, code string, t time.Time, last int64) (int64, bool, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false, fmt.Errorf("decoding secret: %w", err)
+	}
+
+	if len(code) != Digits {
+		return 0, false, nil
+	}
+
+	step := t.Unix() / int64(Period.Seconds())
+
+	var matched int64
+	var valid bool
+	for _, s := range []int64{step - 1, step, step + 1} {
+		if subtle.ConstantTimeCompare([]byte(code), []byte(otp(key, uint64(s)))) == 1 && s > last {
+			matched = s
+			valid = true
+		}
+	}
+
+	return matched, valid, nil
+}
+
+// =============================================================================
+
+// otp implements the HOTP algorithm from RFC 4226 for the specified counter.
+func otp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag returns a strong entity tag for the version of a resource.
+func ETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ETagVariant returns a strong entity tag for the version of a resource when
+// it has more than one representation, like one with fields hidden from the
+// caller. The variant tells the representations apart, and the tag is the
+// one from ETag when the variant is empty.
+func ETagVariant(version int, variant string) string {
+	if variant == "" {
+		return ETag(version)
+	}
+
+	return strconv.Quote(strconv.Itoa(version) + "-" + variant)
+}
+
+// contentCodings are the content codings CodedETag can add to a tag.
+var contentCodings = []string{"br", "gzip"}
+
+// CodedETag returns the entity tag of a representation sent with a content
+// coding, like a compressed response. Each coding of a representation needs
+// a strong tag of its own, so the coding is added to the tag. IfMatch and
+// IfNoneMatch take the coding off again before comparing tags.
+func CodedETag(etag string, coding string) string {
+	if !strings.HasSuffix(etag, `"`) || len(strings.TrimPrefix(etag, "W/")) < 2 {
+		return etag
+	}
+
+	return strings.TrimSuffix(etag, `"`) + "-" + coding + `"`
+}
+
+// uncoded returns the tag without the content coding added by CodedETag.
+func uncoded(tag string) string {
+	for _, coding := range contentCodings {
+		suffix := "-" + coding + `"`
+		if strings.HasSuffix(tag, suffix) {
+			return strings.TrimSuffix(tag, suffix) + `"`
+		}
+	}
+
+	return tag
+}
+
+// SetETag sets the entity tag of the resource in the response.
+func SetETag(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+}
+
+// IfNoneMatch reports if the If-None-Match header of the request matches the
+// entity tag, in which case a GET should be answered with 304. The weak
+// comparison function is used as required for this header, and a tag sent
+// with a content coding matches the tag of the representation.
+func IfNoneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range parseETags(header) {
+		if tag == "*" || strings.TrimPrefix(uncoded(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IfMatch reports if the precondition in the If-Match header of the request
+// holds for the entity tag. A request without the header always holds. The
+// strong comparison function is used, so weak tags never match. A tag sent
+// with a content coding matches the tag of the representation, since it
+// names the same representation before the coding was applied.
+func IfMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, tag := range parseETags(header) {
+		if tag == "*" {
+			return true
+		}
+		if !strings.HasPrefix(tag, "W/") && uncoded(tag) == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseETags splits a list of entity tags. Commas are allowed inside the
+// quoted part of a tag, so the list can't simply be split on commas.
+func parseETags(header string) []string {
+	var tags []string
+
+	for {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			return tags
+		}
+
+		if header[0] == '*' {
+			tags = append(tags, "*")
+			header = header[1:]
+			continue
+		}
+
+		start := 0
+		if strings.HasPrefix(header, "W/") {
+			start = 2
+		}
+
+		if len(header) <= start || header[start] != '"' {
+			return tags
+		}
+
+		end := strings.IndexByte(header[start+1:], '"')
+		if end == -1 {
+			return tags
+		}
+		end += start + 2
+
+		tags = append(tags, header[:end])
+		header = header[end:]
+	}
+}
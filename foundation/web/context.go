@@ -3,6 +3,9 @@ package web
 import (
 	"context"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ctxKey int
@@ -12,8 +15,12 @@ const key ctxKey = 1
 // Values represent state for each request.
 type Values struct {
 	TraceID    string
+	RequestID  string
+	Tracer     trace.Tracer
+	Route      string
 	Now        time.Time
 	StatusCode int
+	Actor      string
 }
 
 // GetValues returns the values from the context.
@@ -38,6 +45,16 @@ func GetTraceID(ctx context.Context) string {
 	return v.TraceID
 }
 
+// GetRequestID returns the request id from the context. It's the id the
+// caller sent in the X-Request-ID header, or the trace id when there was none.
+func GetRequestID(ctx context.Context) string {
+	v, ok := ctx.Value(key).(*Values)
+	if !ok {
+		return "00000000-0000-0000-0000-000000000000"
+	}
+	return v.RequestID
+}
+
 // GetTime returns the time from the context.
 func GetTime(ctx context.Context) time.Time {
 	v, ok := ctx.Value(key).(*Values)
@@ -56,3 +73,16 @@ func SetStatusCode(ctx context.Context, statusCode int) {
 
 	v.StatusCode = statusCode
 }
+
+// AddSpan adds an OpenTelemetry span to the trace and context. The caller is
+// responsible for ending the span.
+func AddSpan(ctx context.Context, spanName string, keyValues ...attribute.KeyValue) (context.Context, trace.Span) {
+	v, ok := ctx.Value(key).(*Values)
+	if !ok || v.Tracer == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	ctx, span := v.Tracer.Start(ctx, spanName, trace.WithAttributes(keyValues...))
+
+	return ctx, span
+}
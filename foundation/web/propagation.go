@@ -0,0 +1,71 @@
+package web
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Set of headers used to correlate requests across services.
+const (
+	TraceIDHeader   = "X-Trace-ID"
+	RequestIDHeader = "X-Request-ID"
+)
+
+// maxRequestIDLen bounds the size of a request id accepted from a caller so
+// it can't be used to flood the logs.
+const maxRequestIDLen = 128
+
+// validRequestID checks the request id is a reasonable size and only
+// contains visible ASCII characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// InjectHeaders adds the trace context and request id of the current request
+// to the headers of an outbound request, so the downstream service can
+// continue the trace and log with the same ids.
+func InjectHeaders(ctx context.Context, h http.Header) {
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(h))
+
+	if v, ok := ctx.Value(key).(*Values); ok && v.RequestID != "" {
+		h.Set(RequestIDHeader, v.RequestID)
+	}
+}
+
+// Transport is a http.RoundTripper that calls InjectHeaders for every
+// request using the request's context. Requests must be constructed with
+// http.NewRequestWithContext using the context passed to the handler.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewTransport wraps the base transport, or http.DefaultTransport when nil.
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{Base: base}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+
+	// A RoundTripper must not modify the request it was given.
+	r = r.Clone(r.Context())
+	InjectHeaders(r.Context(), r.Header)
+
+	return t.Base.RoundTrip(r)
+}
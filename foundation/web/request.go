@@ -1,12 +1,29 @@
 package web
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"reflect"
+	"strings"
 
 	"github.com/dimfeld/httptreemux/v5"
 )
 
+// DefaultMaxBodySize is the number of bytes Decode will read from a request
+// body when the route hasn't set its own limit with SetMaxBodySize.
+const DefaultMaxBodySize = 1 << 20
+
+// Set of errors returned by Decode when the request can't be read.
+var (
+	ErrBodyTooLarge         = errors.New("request body too large")
+	ErrUnsupportedMediaType = errors.New("content type must be application/json")
+)
+
 type validator interface {
 	Validate() error
 }
@@ -17,11 +34,74 @@ func Param(r *http.Request, key string) string {
 	return m[key]
 }
 
+// limitedBody marks a request body that already has a size limit applied.
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+}
+
+// SetMaxBodySize limits the number of bytes that can be read from the
+// request body. Reading past the limit makes Decode return ErrBodyTooLarge.
+func SetMaxBodySize(w http.ResponseWriter, r *http.Request, n int64) {
+	if lb, ok := r.Body.(limitedBody); ok {
+		r.Body = lb.ReadCloser
+	}
+
+	r.Body = limitedBody{
+		ReadCloser: http.MaxBytesReader(w, r.Body, n),
+		limit:      n,
+	}
+}
+
+// ReadBody reads the whole request body within the size limit. The body is
+// replaced with the data read, so the request can still be decoded.
+func ReadBody(r *http.Request) ([]byte, error) {
+	if _, ok := r.Body.(limitedBody); !ok {
+		SetMaxBodySize(nil, r, DefaultMaxBodySize)
+	}
+
+	lb := r.Body.(limitedBody)
+	if r.ContentLength > lb.limit {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, lb.limit)
+	}
+
+	data, err := io.ReadAll(lb)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, maxBytesErr.Limit)
+		}
+		return nil, err
+	}
+
+	r.Body = limitedBody{
+		ReadCloser: io.NopCloser(bytes.NewReader(data)),
+		limit:      lb.limit,
+	}
+
+	return data, nil
+}
+
 // Decode reads the body of an HTTP request looking for a JSON document. The
 // body is decoded into the provided value.
 // If the provided value is a struct then it is checked for validation tags.
 // If the value implements a validate function execute it.
+//
+// The request must declare a JSON content type, and problems with the
+// document are returned as a DecodeError naming the offending field.
 func Decode(r *http.Request, val any) error {
+	if err := checkContentType(r); err != nil {
+		return err
+	}
+
+	if _, ok := r.Body.(limitedBody); !ok {
+		SetMaxBodySize(nil, r, DefaultMaxBodySize)
+	}
+
+	if lb := r.Body.(limitedBody); r.ContentLength > lb.limit {
+		return fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, lb.limit)
+	}
+
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 	// check application layer model we didn't use in-build type like time.Time, email etc.
@@ -31,7 +111,7 @@ func Decode(r *http.Request, val any) error {
 	// we use normal type for us to easily pass decode function first
 	// then continue use validator to valid input value.
 	if err := decoder.Decode(val); err != nil {
-		return err
+		return decodeError(err)
 	}
 
 	// If the value implements a validate function execute it.
@@ -43,3 +123,113 @@ func Decode(r *http.Request, val any) error {
 
 	return nil
 }
+
+// checkContentType accepts application/json and any media type using the
+// +json structured syntax suffix.
+func checkContentType(r *http.Request) error {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return ErrUnsupportedMediaType
+	}
+
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ErrUnsupportedMediaType
+	}
+
+	if mediaType != "application/json" && !(strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")) {
+		return ErrUnsupportedMediaType
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// DecodeError is returned by Decode when the body isn't a valid document
+// for the value. Field is the JSON path of the offending field, or "body"
+// when the problem isn't specific to a field.
+type DecodeError struct {
+	Field string
+	Err   error
+}
+
+// Error implements the error interface.
+func (de *DecodeError) Error() string {
+	return fmt.Sprintf("%s: %s", de.Field, de.Err)
+}
+
+// Unwrap returns the underlying error.
+func (de *DecodeError) Unwrap() error {
+	return de.Err
+}
+
+// IsDecodeError checks if an error of type DecodeError exists.
+func IsDecodeError(err error) bool {
+	var de *DecodeError
+	return errors.As(err, &de)
+}
+
+// GetDecodeError returns a copy of the DecodeError pointer.
+func GetDecodeError(err error) *DecodeError {
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		return nil
+	}
+	return de
+}
+
+// decodeError translates the errors returned by the json package.
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, maxBytesErr.Limit)
+
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{Field: "body", Err: fmt.Errorf("malformed JSON at offset %d", syntaxErr.Offset)}
+
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		return &DecodeError{Field: field, Err: fmt.Errorf("must be of type %s", jsonType(typeErr))}
+
+	case errors.Is(err, io.EOF):
+		return &DecodeError{Field: "body", Err: errors.New("must not be empty")}
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Field: "body", Err: errors.New("malformed JSON")}
+
+	// The json package doesn't export a type for unknown fields.
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &DecodeError{Field: field, Err: errors.New("unknown field")}
+	}
+
+	return &DecodeError{Field: "body", Err: err}
+}
+
+// jsonType describes the expected type in JSON terms instead of Go terms.
+func jsonType(typeErr *json.UnmarshalTypeError) string {
+	switch typeErr.Type.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+
+	return typeErr.Type.String()
+}
@@ -6,11 +6,18 @@ import (
 	"net/http"
 )
 
-// Respond converts a Go value to JSON and sends it to the client.
+// Respond converts a Go value to JSON and sends it to the client. Responses
+// with a 204 or 304 status code have no body.
 func Respond(ctx context.Context, w http.ResponseWriter, data any, statusCode int) error {
+	return RespondAs(ctx, w, data, statusCode, "application/json")
+}
+
+// RespondAs converts a Go value to JSON and sends it to the client as the
+// content type, for JSON based media types like application/problem+json.
+func RespondAs(ctx context.Context, w http.ResponseWriter, data any, statusCode int, contentType string) error {
 	SetStatusCode(ctx, statusCode)
 
-	if statusCode == http.StatusNoContent {
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
 		w.WriteHeader(statusCode)
 		return nil
 	}
@@ -20,7 +27,7 @@ func Respond(ctx context.Context, w http.ResponseWriter, data any, statusCode in
 		return err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(statusCode)
 
 	if _, err := w.Write(jsonData); err != nil {
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ContentTypeEventStream is the content type of server-sent events.
+const ContentTypeEventStream = "text/event-stream"
+
+// EventStream sends server-sent events to the client. Each event is flushed
+// as it's sent, and each flush must complete within the write timeout of
+// streams, which replaces the server's write timeout.
+type EventStream struct {
+	ctx context.Context
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	buf bytes.Buffer
+}
+
+// NewEventStream starts a server-sent events response. Retry tells the
+// client how long to wait before reconnecting when the stream ends.
+func NewEventStream(ctx context.Context, w http.ResponseWriter, retry time.Duration) (*EventStream, error) {
+	es := EventStream{
+		ctx: ctx,
+		w:   w,
+		rc:  http.NewResponseController(w),
+	}
+
+	// Like for streams, the write timeout starts before the headers are
+	// written so the server's write timeout can't end the stream.
+	if err := es.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+		return nil, fmt.Errorf("setting write deadline: %w", err)
+	}
+
+	SetStatusCode(ctx, http.StatusOK)
+
+	w.Header().Set("Content-Type", ContentTypeEventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(&es.buf, "retry: %d\n\n", retry.Milliseconds())
+	if err := es.flush(); err != nil {
+		return nil, err
+	}
+
+	return &es, nil
+}
+
+// Send sends an event with the id and name. The data is encoded like it
+// would be for a JSON response. It returns an error once the client has
+// gone away.
+func (es *EventStream) Send(id string, name string, data any) error {
+	if err := es.ctx.Err(); err != nil {
+		return es.fail(err)
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return es.fail(err)
+	}
+
+	if id != "" {
+		fmt.Fprintf(&es.buf, "id: %s\n", id)
+	}
+	if name != "" {
+		fmt.Fprintf(&es.buf, "event: %s\n", name)
+	}
+	fmt.Fprintf(&es.buf, "data: %s\n\n", payload)
+
+	return es.flush()
+}
+
+// Heartbeat sends a comment, which clients ignore. It keeps proxies from
+// closing a connection that is idle because nothing happened.
+func (es *EventStream) Heartbeat() error {
+	if err := es.ctx.Err(); err != nil {
+		return es.fail(err)
+	}
+
+	es.buf.WriteString(": heartbeat\n\n")
+
+	return es.flush()
+}
+
+func (es *EventStream) flush() error {
+	defer es.buf.Reset()
+
+	if err := es.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+		return es.fail(err)
+	}
+
+	if _, err := es.w.Write(es.buf.Bytes()); err != nil {
+		return es.fail(err)
+	}
+
+	if err := es.rc.Flush(); err != nil {
+		return es.fail(err)
+	}
+
+	return nil
+}
+
+func (es *EventStream) fail(err error) error {
+	return &StreamError{Err: err}
+}
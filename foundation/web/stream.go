@@ -0,0 +1,329 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set of content types that can be streamed.
+const (
+	ContentTypeCSV    = "text/csv"
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+// Streaming settings. The buffered records are flushed to the client every
+// flushEvery records, and each flush must complete within the write timeout.
+// The timeout replaces the server's write timeout, which would otherwise end
+// long exports.
+const (
+	flushEvery         = 100
+	streamWriteTimeout = 30 * time.Second
+)
+
+// StreamType returns the streaming content type the client prefers based on
+// the Accept header, or an empty string when a regular response is wanted.
+func StreamType(r *http.Request) string {
+	var streamType string
+	var streamQ, otherQ float64
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, exists := params["q"]; exists {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case ContentTypeCSV, ContentTypeNDJSON:
+			if q > streamQ {
+				streamType, streamQ = mediaType, q
+			}
+		default:
+			otherQ = max(otherQ, q)
+		}
+	}
+
+	if streamQ == 0 || streamQ < otherQ {
+		return ""
+	}
+
+	return streamType
+}
+
+// Columns returns the json names of the fields of the struct value. They are
+// used as the CSV header of a stream.
+func Columns(v any) []string {
+	rt := reflect.TypeOf(v)
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+
+	var columns []string
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = sf.Name
+		}
+
+		columns = append(columns, name)
+	}
+
+	return columns
+}
+
+// =============================================================================
+
+// Stream writes a sequence of values to the client as they are produced,
+// so the whole response is never held in memory.
+type Stream struct {
+	ctx     context.Context
+	rc      *http.ResponseController
+	columns []string
+	csv     *csv.Writer
+	enc     *json.Encoder
+	pending int
+}
+
+// NewStream starts a streaming response of the specified content type. For
+// CSV the columns are written as the header and select the fields written
+// for each value.
+func NewStream(ctx context.Context, w http.ResponseWriter, contentType string, columns []string) (*Stream, error) {
+	s := Stream{
+		ctx:     ctx,
+		rc:      http.NewResponseController(w),
+		columns: columns,
+	}
+
+	switch contentType {
+	case ContentTypeCSV:
+		s.csv = csv.NewWriter(w)
+	case ContentTypeNDJSON:
+		s.enc = json.NewEncoder(w)
+	default:
+		return nil, fmt.Errorf("content type %q can't be streamed", contentType)
+	}
+
+	// The stream's write timeout starts before anything is written, so the
+	// server's write timeout, counted from the start of the request, can't
+	// end an export that is slow to produce its first records.
+	if err := s.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+		return nil, fmt.Errorf("setting write deadline: %w", err)
+	}
+
+	SetStatusCode(ctx, http.StatusOK)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if s.csv != nil {
+		if err := s.csv.Write(columns); err != nil {
+			return nil, s.fail(err)
+		}
+	}
+
+	return &s, nil
+}
+
+// Write adds the value to the stream. The value is encoded like it would be
+// for a JSON response. It returns an error once the client has gone away.
+func (s *Stream) Write(v any) error {
+	if err := s.ctx.Err(); err != nil {
+		return s.fail(err)
+	}
+
+	switch {
+	case s.csv != nil:
+		record, err := csvRecord(v, s.columns)
+		if err != nil {
+			return s.fail(err)
+		}
+		if err := s.csv.Write(record); err != nil {
+			return s.fail(err)
+		}
+
+	default:
+		if err := s.enc.Encode(v); err != nil {
+			return s.fail(err)
+		}
+	}
+
+	s.pending++
+	if s.pending < flushEvery {
+		return nil
+	}
+
+	return s.flush()
+}
+
+// Close completes the stream. The error from producing the values should be
+// passed in. Once the response has started there is no way to report an
+// error to the client, so the stream is cut short and a StreamError is
+// returned to be logged. A client that went away isn't treated as an error.
+func (s *Stream) Close(err error) error {
+	if err == nil {
+		err = s.flush()
+	}
+
+	switch {
+	case err == nil:
+		return nil
+
+	case s.ctx.Err() != nil:
+		return nil
+	}
+
+	return s.fail(err)
+}
+
+func (s *Stream) flush() error {
+	s.pending = 0
+
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return s.fail(err)
+		}
+	}
+
+	if err := s.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+		return s.fail(err)
+	}
+
+	if err := s.rc.Flush(); err != nil {
+		return s.fail(err)
+	}
+
+	return nil
+}
+
+func (s *Stream) fail(err error) error {
+	var se *StreamError
+	if errors.As(err, &se) {
+		return err
+	}
+
+	return &StreamError{Err: err}
+}
+
+// =============================================================================
+
+// StreamError is returned when a stream fails after the response started.
+type StreamError struct {
+	Err error
+}
+
+// Error implements the error interface.
+func (se *StreamError) Error() string {
+	return "stream: " + se.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (se *StreamError) Unwrap() error {
+	return se.Err
+}
+
+// IsStreamError checks if an error of type StreamError exists.
+func IsStreamError(err error) bool {
+	var se *StreamError
+	return errors.As(err, &se)
+}
+
+// =============================================================================
+
+// csvRecord encodes the value as JSON and picks the columns out of it, so
+// values that customize their JSON encoding are written the same way.
+func csvRecord(v any, columns []string) ([]string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("value of type %T is not an object: %w", v, err)
+	}
+
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		raw, exists := fields[column]
+		if !exists {
+			continue
+		}
+		record[i] = csvValue(raw)
+	}
+
+	return record, nil
+}
+
+// csvValue converts a JSON value into a CSV field. Strings are unquoted,
+// arrays of scalars are joined with semicolons and objects are kept as JSON.
+// Text that a spreadsheet would run as a formula is escaped.
+func csvValue(raw json.RawMessage) string {
+	var value any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return string(raw)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+
+	case string:
+		return csvText(v)
+
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				return string(raw)
+			}
+			items[i] = fmt.Sprint(item)
+		}
+		return csvText(strings.Join(items, ";"))
+
+	case map[string]any:
+		return string(raw)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// csvText escapes text starting with a character that makes spreadsheets
+// treat a cell as a formula, by putting a quote in front of it. Only exports
+// to CSV are opened in spreadsheets, so NDJSON keeps the text as is.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -6,11 +6,25 @@ import (
 	"errors"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/dimfeld/httptreemux/v5"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Set of errors returned through the middleware for requests that don't
+// match a route.
+var (
+	ErrRouteNotFound    = errors.New("route not found")
+	ErrMethodNotAllowed = errors.New("method not allowed")
 )
 
 // A Handler is a type that handles a http request within our own little mini
@@ -21,18 +35,34 @@ type Handler func(ctx context.Context, w http.ResponseWriter, r *http.Request) e
 // object for each of our http handlers. Feel free to add any configuration
 // data/logic on this App struct.
 type App struct {
-	*httptreemux.ContextMux
+	mux      *httptreemux.ContextMux
+	otmux    http.Handler
 	shutdown chan os.Signal
 	mw       []Middleware
+	tracer   trace.Tracer
+	routes   []string
 }
 
 // NewApp creates an App value that handle a set of routes for the application.
-func NewApp(shutdown chan os.Signal, mw ...Middleware) *App {
-	return &App{
-		ContextMux: httptreemux.NewContextMux(),
-		shutdown:   shutdown,
-		mw:         mw,
+// Every request is traced with the provided tracer.
+func NewApp(shutdown chan os.Signal, tracer trace.Tracer, mw ...Middleware) *App {
+
+	// Create an OpenTelemetry HTTP Handler which wraps our router. This will start
+	// the initial span and annotate it with information about the request/response.
+	mux := httptreemux.NewContextMux()
+
+	app := App{
+		mux:      mux,
+		otmux:    otelhttp.NewHandler(mux, "request"),
+		shutdown: shutdown,
+		mw:       mw,
+		tracer:   tracer,
 	}
+
+	mux.NotFoundHandler = app.notFound
+	mux.MethodNotAllowedHandler = app.methodNotAllowed
+
+	return &app
 }
 
 // SignalShutdown is used to gracefully shut down the app when an integrity
@@ -41,31 +71,204 @@ func (a *App) SignalShutdown() {
 	a.shutdown <- syscall.SIGTERM
 }
 
+// ServeHTTP implements the http.Handler interface. It's the entry point for
+// all http traffic and allows the opentelemetry mux to run first to handle
+// tracing. The opentelemetry mux then calls the application mux to handle
+// application traffic.
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.otmux.ServeHTTP(w, r)
+}
+
+// EnableCORS adds the CORS middleware to every route and answers the
+// preflight requests for every registered route with only that middleware
+// applied, since a preflight carries no credentials and must not reach the
+// route's handler.
+func (a *App) EnableCORS(mw Middleware) {
+	a.mw = append(a.mw, mw)
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return Respond(ctx, w, nil, http.StatusNoContent)
+	}
+	handler = wrapMiddleware([]Middleware{mw}, handler)
+
+	a.mux.OptionsHandler = func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		v := Values{
+			TraceID: uuid.NewString(),
+			Tracer:  a.tracer,
+			Now:     time.Now().UTC(),
+		}
+		ctx := context.WithValue(r.Context(), key, &v)
+
+		handler(ctx, w, r)
+	}
+}
+
 // Handle sets a handler function for a given HTTP method and path pair
 // to the application server mux.
 func (a *App) Handle(method string, path string, handler Handler, mw ...Middleware) {
 	handler = wrapMiddleware(mw, handler)
 	handler = wrapMiddleware(a.mw, handler)
 
+	a.mux.Handle(method, path, a.serve(path, handler))
+	a.routes = append(a.routes, method+" "+path)
+}
+
+// Routes returns the routes handled by the app in the form "METHOD path",
+// sorted. The preflight requests answered for CORS aren't included.
+func (a *App) Routes() []string {
+	routes := append([]string{}, a.routes...)
+	sort.Strings(routes)
+
+	return routes
+}
+
+// Group returns a set of routes that share the path prefix and the
+// middleware. The middleware runs after the app's middleware and before the
+// middleware of each route.
+func (a *App) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{
+		app:    a,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		mw:     mw,
+	}
+}
+
+// serve adapts the handler to the mux, setting up the values and the span
+// for the request.
+func (a *App) serve(path string, handler Handler) func(w http.ResponseWriter, r *http.Request) {
 	h := func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := a.startSpan(r, path)
+		defer span.End()
+
+		// The trace id of the span is used for logging, so logs and traces
+		// can be correlated. The span continues the trace of an incoming
+		// traceparent header. Without a tracer or traceparent there is no
+		// valid trace id.
+		traceID := uuid.NewString()
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			traceID = sc.TraceID().String()
+		}
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = traceID
+		}
 
 		v := Values{
-			TraceID: uuid.NewString(),
-			Now:     time.Now().UTC(),
+			TraceID:   traceID,
+			RequestID: requestID,
+			Tracer:    a.tracer,
+			Route:     path,
+			Now:       time.Now().UTC(),
 		}
-		ctx := context.WithValue(r.Context(), key, &v)
+		ctx = context.WithValue(ctx, key, &v)
+
+		w.Header().Set(TraceIDHeader, traceID)
+		w.Header().Set(RequestIDHeader, requestID)
+
+		err := handler(ctx, w, r)
 
-		if err := handler(ctx, w, r); err != nil {
+		span.SetAttributes(attribute.Int("http.status_code", v.StatusCode))
+		if v.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(v.StatusCode))
+		}
+
+		if err != nil {
+			span.RecordError(err)
 			if validateShutdown(err) {
 				a.SignalShutdown()
 				return
 			}
 		}
+	}
+
+	return h
+}
+
+// unmatchedRoute is the route recorded for requests that don't match one.
+const unmatchedRoute = "unmatched"
+
+// notFound answers requests for paths without a route. The error is
+// returned through the app's middleware so it's reported like any other.
+func (a *App) notFound(w http.ResponseWriter, r *http.Request) {
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return ErrRouteNotFound
+	}
+
+	a.serve(unmatchedRoute, wrapMiddleware(a.mw, handler))(w, r)
+}
+
+// methodNotAllowed answers requests for paths with a route that doesn't
+// support the method. The Allow header lists the methods that are.
+func (a *App) methodNotAllowed(w http.ResponseWriter, r *http.Request, methods map[string]httptreemux.HandlerFunc) {
+	allow := make([]string, 0, len(methods))
+	for method := range methods {
+		allow = append(allow, method)
+	}
+	sort.Strings(allow)
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		return ErrMethodNotAllowed
+	}
+
+	a.serve(unmatchedRoute, wrapMiddleware(a.mw, handler))(w, r)
+}
+
+// =============================================================================
+
+// Group is a set of routes that share a path prefix and middleware. Groups
+// can be nested, for example to version an API and then group the routes of
+// a version that require authentication.
+type Group struct {
+	app    *App
+	prefix string
+	mw     []Middleware
+}
+
+// Group returns a set of routes nested in this group. The path prefix is
+// appended to the group's and the middleware runs after the group's.
+func (g *Group) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{
+		app:    g.app,
+		prefix: g.prefix + strings.TrimSuffix(prefix, "/"),
+		mw:     append(append([]Middleware{}, g.mw...), mw...),
+	}
+}
+
+// Handle sets a handler function for a given HTTP method and path, relative
+// to the group's prefix. The group's middleware runs before the route's.
+func (g *Group) Handle(method string, path string, handler Handler, mw ...Middleware) {
+	all := append(append([]Middleware{}, g.mw...), mw...)
+	g.app.Handle(method, g.prefix+path, handler, all...)
+}
+
+// startSpan starts the span for the handler as a child of the span created
+// by the opentelemetry mux.
+func (a *App) startSpan(r *http.Request, path string) (context.Context, trace.Span) {
+	ctx := r.Context()
+
+	// The opentelemetry mux only continues an incoming trace when a global
+	// propagator is configured. Otherwise the traceparent header is read
+	// here so the trace id is still honoured.
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = propagation.TraceContext{}.Extract(ctx, propagation.HeaderCarrier(r.Header))
+	}
+
+	// There are times when the handler is called without a tracer, such
+	// as with tests. We need a span for the trace id.
+	span := trace.SpanFromContext(ctx)
 
-		// ANY CODE I WANT
+	if a.tracer != nil {
+		ctx, span = a.tracer.Start(ctx, "foundation.web.handle",
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.route", path),
+			),
+		)
 	}
 
-	a.ContextMux.Handle(method, path, h)
+	return ctx, span
 }
 
 // validateShutdown validates the error for special conditions that do not